@@ -15,12 +15,19 @@ Usage:	dynconf command [arguments]
 
 The commands are:
 
-	apply	Apply a recipe and commit the result
-	check	Validate a recipe
-	show	Apply a recipe and output the result
+	apply     Apply a recipe and commit the result
+	check     Validate a recipe
+	fmt       Format recipes in canonical style
+	history   List the generations of a configuration file
+	lint      Warn about entries that probably do not work as intended
+	migrate   Rewrite recipes in the current version of the format
+	rollback  Restore a previous generation of a configuration file
+	schema    Print a JSON Schema for recipes
+	show      Apply a recipe and output the result
+	status    Report the state of configuration files and reconcile saved files
 
-	help	Print this help message
-	version	Show version information
+	help      Print this help message
+	version   Show version information
 `
 
 const version = `
@@ -52,8 +59,22 @@ func main() {
 		internal.Apply(args[1:])
 	case "check":
 		internal.Check(args[1:])
+	case "fmt":
+		internal.Fmt(args[1:])
+	case "history":
+		internal.History(args[1:])
+	case "lint":
+		internal.Lint(args[1:])
+	case "migrate":
+		internal.Migrate(args[1:])
+	case "rollback":
+		internal.Rollback(args[1:])
+	case "schema":
+		internal.Schema(args[1:])
 	case "show":
 		internal.Show(args[1:])
+	case "status":
+		internal.Status(args[1:])
 
 	case "help":
 		printUsage()
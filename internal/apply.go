@@ -3,52 +3,173 @@
 package internal
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/hahnjo/dynconf/pkg"
 )
 
 func Apply(args []string) {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Command 'apply' requires a recipe")
+	var opts recipeOptions
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	opts.addFlags(flags)
+	addSettingsFlags(flags)
+	force := flags.Bool("force", false, "overwrite configuration files that were modified since the last apply")
+	merge := flags.Bool("merge", false, "merge modifications since the last apply into the new output")
+	flags.Parse(args)
+	recipes := opts.recipes("apply", flags.Args())
+	loadSettings()
+
+	targets := groupTargets(recipes)
+
+	// Apply the recipes to all files before committing any of them.
+	configs := make([]*dynconf.Config, len(targets))
+	origs := make([][]byte, len(targets))
+	modifieds := make([][]byte, len(targets))
+	merged := make([][]byte, len(targets))
+	conflicts := make([]bool, len(targets))
+	failed := false
+	for idx, t := range targets {
+		c, err := dynconf.NewConfig(t.File)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding input for %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+		if s := c.State(); s == dynconf.StateRemoved || s == dynconf.StateReinstalled {
+			fmt.Fprintf(os.Stderr, "Package of %s was %s, reconcile %s with 'dynconf status --reconcile'\n", t.File, s, c.Saved())
+			failed = true
+			continue
+		}
+		hash, err := dynconf.HashRecipes(t.Recipes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error hashing recipes for %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+		c.SetRecipeHash(hash)
+		if !prepareTarget(c, t) {
+			failed = true
+			continue
+		}
+		// Resolve owner and group before committing any of the files.
+		attrs, _ := t.Attributes()
+		err = attrs.Check()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving attributes of %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+		orig, err := c.ReadInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", c.GetInput(), err)
+			failed = true
+			continue
+		}
+
+		modified, errs := dynconf.ApplyStackToInput(t.Recipes, orig)
+		if len(errs) != 0 {
+			fmt.Fprintf(os.Stderr, "Recipes could not be applied to %s:\n", t.File)
+			for _, e := range errs {
+				fmt.Printf("error: %s\n", e)
+			}
+			failed = true
+			continue
+		}
+
+		if !*force {
+			var ok bool
+			merged[idx], conflicts[idx], ok = handleEdits(c, t.File, modified, *merge)
+			if !ok {
+				failed = true
+				continue
+			}
+		}
+
+		configs[idx], origs[idx], modifieds[idx] = c, orig, modified
+	}
+	if failed {
 		os.Exit(1)
 	}
 
-	file := args[0]
-	var r dynconf.Recipe
-	err := r.Read(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading recipe '%s': %s\n", file, err)
-		os.Exit(1)
+	for idx, c := range configs {
+		leftovers := c.Leftovers()
+		var err error
+		if merged[idx] != nil {
+			err = c.CommitMerged(origs[idx], modifieds[idx], merged[idx])
+		} else {
+			err = c.Commit(origs[idx], modifieds[idx])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error commiting %s: %s\n", targets[idx].File, err)
+			os.Exit(1)
+		}
+		for _, l := range leftovers {
+			fmt.Printf("Removed leftover update file %s.\n", l)
+		}
+		if conflicts[idx] {
+			fmt.Printf("Merged modifications into %s with conflicts, resolve them and apply again.\n", targets[idx].File)
+			failed = true
+		} else if merged[idx] != nil {
+			fmt.Printf("Merged modifications into %s.\n", targets[idx].File)
+		}
 	}
 
-	errs, _ := r.Validate()
-	if len(errs) > 0 {
-		fmt.Fprintf(os.Stderr, "Recipe '%s' is invalid:\n", file)
-		for _, e := range errs {
-			fmt.Printf("error: %s\n", e)
+	if len(recipes) > 1 || len(targets) != 1 || targets[0].File != recipes[0].File {
+		fmt.Printf("Applied %d recipes to %d files:\n", len(recipes), len(targets))
+		for _, t := range targets {
+			fmt.Printf("  %s (%d recipes)\n", t.File, len(t.Recipes))
 		}
+	}
+	if failed {
 		os.Exit(1)
 	}
 
-	c := dynconf.NewConfig(r.File)
-	input := c.GetInput()
+	os.Exit(0)
+}
 
-	orig, modified, errs := dynconf.ApplyToFile(r, input)
-	if len(errs) != 0 {
-		fmt.Fprintf(os.Stderr, "Recipe '%s' could not be applied:\n", file)
-		for _, e := range errs {
-			fmt.Printf("error: %s\n", e)
-		}
-		os.Exit(1)
+// Handle modifications of the configuration file since the last apply. If
+// there are none, it returns nil. Otherwise with merge, it merges them into
+// modified and returns the result and whether it has conflicts. Without merge,
+// or if merging is not possible, it prints the modifications and returns false
+// as the last value.
+func handleEdits(c *dynconf.Config, file string, modified []byte, merge bool) ([]byte, bool, bool) {
+	edited, err := c.Edited()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking %s for modifications: %s\n", file, err)
+		return nil, false, false
+	} else if !edited {
+		return nil, false, true
 	}
 
-	err = c.Commit(orig, modified)
+	current, err := ioutil.ReadFile(file)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error commiting %s: %s\n", r.File, err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", file, err)
+		return nil, false, false
+	}
+	last, err := c.LastOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading last output for %s: %s\n", file, err)
+		return nil, false, false
 	}
 
-	os.Exit(0)
+	if merge && last != nil {
+		result, clean := dynconf.Merge(last, current, file, modified, "new output")
+		return result, !clean, true
+	}
+
+	if merge {
+		fmt.Fprintf(os.Stderr, "%s was modified since the last apply, but the last output is unknown and cannot be merged:\n", file)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s was modified since the last apply, use --merge to keep or --force to overwrite the modifications:\n", file)
+	}
+	if last != nil {
+		os.Stdout.Write(dynconf.Diff(file+" (last apply)", last, file, current))
+	} else {
+		// Without the last output, show what would be lost.
+		os.Stdout.Write(dynconf.Diff(file+" (new output)", modified, file, current))
+	}
+	return nil, false, false
 }
@@ -3,6 +3,7 @@
 package internal
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -10,36 +11,104 @@ import (
 )
 
 func Check(args []string) {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Command 'check' requires a recipe")
-		os.Exit(1)
-	}
+	var opts recipeOptions
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	opts.addFlags(flags)
+	addSettingsFlags(flags)
+	effective := flags.Bool("effective", false, "print the effective recipe after resolving 'extends'")
+	flags.Parse(args)
+	files := opts.files("check", flags.Args())
 
-	file := args[0]
-	var r dynconf.Recipe
-	err := r.Read(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading recipe '%s': %s\n", file, err)
-		os.Exit(1)
-	}
+	recipes := make([]dynconf.Recipe, 0, len(files))
+	for _, file := range files {
+		r, warns := opts.readRecipe(file)
+		if !opts.filter.Match(&r) {
+			continue
+		}
+		recipes = append(recipes, r)
 
-	errs, warns := r.Validate()
-	if len(errs) > 0 {
-		fmt.Fprintf(os.Stderr, "Recipe '%s' is invalid:\n", file)
-		for _, e := range errs {
-			fmt.Printf("error: %s\n", e)
+		fmt.Printf("Recipe '%s' is valid.\n", file)
+
+		if len(warns) > 0 {
+			fmt.Println()
+			for _, w := range warns {
+				fmt.Printf("warning: %s\n", w)
+			}
+		}
+
+		if *effective {
+			fmt.Println()
+			err := r.Encode(os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error printing recipe '%s': %s\n", file, err)
+				os.Exit(1)
+			}
 		}
-		os.Exit(1)
 	}
 
-	fmt.Printf("Recipe '%s' is valid.\n", file)
+	if len(recipes) > 1 {
+		_, err := dynconf.SortRecipes(recipes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recipes cannot be ordered: %s\n", err)
+			os.Exit(1)
+		}
 
-	if len(warns) > 0 {
-		fmt.Println()
-		for _, w := range warns {
-			fmt.Printf("warning: %s\n", w)
+		// Only check targets that exist on this host, so that check also
+		// works for recipes of other hosts.
+		loadSettings()
+		targets, err := dynconf.GroupExistingTargets(recipes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error expanding files of recipes: %s\n", err)
+			os.Exit(1)
+		}
+		if !checkStacks(targets) {
+			os.Exit(1)
 		}
 	}
 
 	os.Exit(0)
 }
+
+// Apply the recipes of all targets with several recipes to their input to
+// find conflicts between them. Targets whose input does not exist or cannot
+// be chosen are skipped. Returns false after printing errors.
+func checkStacks(targets []dynconf.Target) bool {
+	ok := true
+	for _, t := range targets {
+		if len(t.Recipes) < 2 {
+			continue
+		}
+
+		c, err := dynconf.NewConfig(t.File)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Not checking recipes of %s: %s\n", t.File, err)
+			continue
+		}
+		create, template, err := t.Create()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error preparing to create %s: %s\n", t.File, err)
+			ok = false
+			continue
+		} else if create {
+			c.Create(template)
+		}
+		input, err := c.ReadInput()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", c.GetInput(), err)
+			ok = false
+			continue
+		}
+
+		_, errs := dynconf.ApplyStackToInput(t.Recipes, input)
+		if len(errs) != 0 {
+			fmt.Fprintf(os.Stderr, "Recipes could not be applied to %s:\n", t.File)
+			for _, e := range errs {
+				fmt.Printf("error: %s\n", e)
+			}
+			ok = false
+		}
+	}
+	return ok
+}
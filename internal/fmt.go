@@ -0,0 +1,64 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+func printFormatError(file string, err error) {
+	if errs, ok := err.(dynconf.Errors); ok {
+		fmt.Fprintf(os.Stderr, "Error formatting recipe '%s':\n", file)
+		for _, e := range errs {
+			fmt.Printf("error: %s\n", e)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Error formatting recipe '%s': %s\n", file, err)
+	}
+}
+
+func Fmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the recipe instead of printing it")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Command 'fmt' expects at least one recipe")
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range flags.Args() {
+		if *write {
+			changed, err := dynconf.FormatFile(file)
+			if err != nil {
+				printFormatError(file, err)
+				failed = true
+			} else if changed {
+				fmt.Printf("Formatted recipe '%s'.\n", file)
+			}
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			data, err = dynconf.Format(file, data)
+		}
+		if err != nil {
+			printFormatError(file, err)
+			failed = true
+			continue
+		}
+		os.Stdout.Write(data)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+func History(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	addSettingsFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Command 'history' expects at least one configuration file")
+		os.Exit(1)
+	}
+	loadSettings()
+
+	failed := false
+	for idx, file := range flags.Args() {
+		generations, err := dynconf.History(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading history of %s: %s\n", file, err)
+			failed = true
+			continue
+		}
+
+		if idx > 0 {
+			fmt.Println()
+		}
+		if len(generations) == 0 {
+			fmt.Printf("No generations of %s.\n", file)
+			continue
+		}
+		current, _ := ioutil.ReadFile(file)
+		fmt.Printf("Generations of %s:\n", file)
+		for _, g := range generations {
+			fmt.Printf("  %d  %s", g.Number, g.Time.Format("2006-01-02 15:04:05"))
+			if len(g.RecipeHash) >= 12 {
+				fmt.Printf("  recipes %s", g.RecipeHash[:12])
+			}
+			if g.Rollback != 0 {
+				fmt.Printf("  rollback to %d", g.Rollback)
+			}
+			if output, err := g.Output(); err == nil && bytes.Equal(output, current) {
+				fmt.Print("  (current)")
+			}
+			fmt.Println()
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func Rollback(args []string) {
+	flags := flag.NewFlagSet("rollback", flag.ExitOnError)
+	addSettingsFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "Command 'rollback' expects a configuration file and optionally a generation")
+		os.Exit(1)
+	}
+	file := flags.Arg(0)
+	number := 0
+	if flags.NArg() == 2 {
+		var err error
+		number, err = strconv.Atoi(flags.Arg(1))
+		if err != nil || number <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid generation: %s\n", flags.Arg(1))
+			os.Exit(1)
+		}
+	}
+	loadSettings()
+
+	c, err := dynconf.NewConfig(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding input for %s: %s\n", file, err)
+		os.Exit(1)
+	}
+	number, err = c.Rollback(number)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rolling back %s: %s\n", file, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Rolled back %s to generation %d.\n", file, number)
+
+	os.Exit(0)
+}
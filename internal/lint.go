@@ -0,0 +1,42 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func Lint(args []string) {
+	var opts recipeOptions
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	opts.addFlags(flags)
+	flags.Parse(args)
+	files := opts.files("lint", flags.Args())
+
+	warned := false
+	for _, file := range files {
+		r, warns := opts.readRecipe(file)
+		if !opts.filter.Match(&r) {
+			continue
+		}
+		warns = append(warns, r.Lint()...)
+
+		if len(warns) == 0 {
+			fmt.Printf("Recipe '%s' has no warnings.\n", file)
+			continue
+		}
+
+		warned = true
+		fmt.Printf("Recipe '%s' has %d warnings:\n", file, len(warns))
+		for _, w := range warns {
+			fmt.Printf("warning: %s\n", w)
+		}
+	}
+
+	if warned {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
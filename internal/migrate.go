@@ -0,0 +1,97 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+func Migrate(args []string) {
+	var opts recipeOptions
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	orig := flags.Bool("orig", false, "move the unmodified copies of the configuration files of the recipes into the state directory instead")
+	opts.addFlags(flags)
+	addSettingsFlags(flags)
+	flags.Parse(args)
+	if *orig {
+		migrateOrig(&opts, flags.Args())
+	}
+
+	// Recipes are migrated as named, the other flags only select recipes
+	// and configuration files for --orig.
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "orig" {
+			fmt.Fprintf(os.Stderr, "Command 'migrate' only accepts --%s with --orig\n", f.Name)
+			os.Exit(1)
+		}
+	})
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Command 'migrate' expects at least one recipe")
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range flags.Args() {
+		version, err := dynconf.MigrateFile(file)
+		if errs, ok := err.(dynconf.Errors); ok {
+			fmt.Fprintf(os.Stderr, "Error migrating recipe '%s':\n", file)
+			for _, e := range errs {
+				fmt.Printf("error: %s\n", e)
+			}
+			failed = true
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error migrating recipe '%s': %s\n", file, err)
+			failed = true
+			continue
+		}
+
+		if version == dynconf.CurrentVersion {
+			fmt.Printf("Recipe '%s' is already in version %d.\n", file, version)
+		} else {
+			fmt.Printf("Migrated recipe '%s' from version %d to %d.\n", file, version, dynconf.CurrentVersion)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Move the unmodified copies of the configuration files into the state
+// directory, exiting when done.
+func migrateOrig(opts *recipeOptions, args []string) {
+	recipes := opts.recipes("migrate", args)
+	loadSettings()
+
+	targets := groupTargets(recipes)
+
+	failed := false
+	moved := 0
+	for _, t := range targets {
+		orig, err := dynconf.MigrateOrig(t.File)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error moving unmodified copy of %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+		if orig != "" {
+			fmt.Printf("Moved %s.orig to %s.\n", t.File, orig)
+			moved++
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	if moved == 0 {
+		fmt.Println("No unmodified copies to move.")
+	}
+	os.Exit(0)
+}
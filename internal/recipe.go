@@ -0,0 +1,199 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+// A flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// A flag for the format of recipes.
+type formatValue dynconf.RecipeFormat
+
+func (f *formatValue) String() string {
+	return string(*f)
+}
+
+func (f *formatValue) Set(value string) error {
+	format, err := dynconf.ParseFormat(value)
+	*f = formatValue(format)
+	return err
+}
+
+// Options shared by all commands that take recipes.
+type recipeOptions struct {
+	all     bool
+	filter  dynconf.Filter
+	format  dynconf.RecipeFormat
+	baseDir string
+}
+
+func (o *recipeOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.all, "all", false, "process all recipes in "+strings.Join(dynconf.RecipeDirs, ", "))
+	flags.Var((*stringList)(&o.filter.Names), "name", "only process recipes with this name (can be repeated)")
+	flags.Var((*stringList)(&o.filter.Tags), "tag", "only process recipes with this tag (can be repeated)")
+	flags.Var((*formatValue)(&o.format), "format", "read recipes in this format (yaml, json, or toml) instead of detecting it from the extension")
+	flags.StringVar(&o.baseDir, "base-dir", "", "resolve relative paths in the recipe from stdin against this directory")
+}
+
+// Return the recipe files named as arguments or found in the recipe
+// directories, exiting on errors.
+func (o *recipeOptions) files(command string, args []string) []string {
+	if !o.all {
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Command '%s' requires a recipe\n", command)
+			os.Exit(1)
+		}
+		stdin := 0
+		for _, arg := range args {
+			if arg == "-" {
+				stdin++
+			}
+		}
+		if stdin > 1 {
+			fmt.Fprintf(os.Stderr, "Command '%s' can only read one recipe from stdin\n", command)
+			os.Exit(1)
+		}
+		return args
+	}
+
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Command '%s' does not take recipes with --all\n", command)
+		os.Exit(1)
+	}
+
+	files, err := dynconf.FindRecipes(dynconf.RecipeDirs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding recipes: %s\n", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No recipes found in %s.\n", strings.Join(dynconf.RecipeDirs, ", "))
+		os.Exit(0)
+	}
+	return files
+}
+
+// Read and validate a recipe, or decode it from stdin if file is "-", exiting
+// on errors. Returns the recipe and the warnings from validation.
+func (o *recipeOptions) readRecipe(file string) (dynconf.Recipe, []error) {
+	format := o.format
+	if format == "" {
+		format = dynconf.FormatOf(file)
+	}
+
+	var r dynconf.Recipe
+	var err error
+	if file == "-" {
+		err = r.DecodeFormat(os.Stdin, format, o.baseDir)
+	} else {
+		err = r.ReadFormat(file, format)
+	}
+	if errs, ok := err.(dynconf.Errors); ok {
+		fmt.Fprintf(os.Stderr, "Error reading recipe '%s':\n", file)
+		for _, e := range errs {
+			fmt.Printf("error: %s\n", e)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading recipe '%s': %s\n", file, err)
+		os.Exit(1)
+	}
+
+	errs, warns := r.Validate()
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Recipe '%s' is invalid:\n", file)
+		for _, e := range errs {
+			fmt.Printf("error: %s\n", e)
+		}
+		os.Exit(1)
+	}
+
+	return r, warns
+}
+
+// Read and validate the recipes named in args, or all recipes in the recipe
+// directories with --all, and return those selected by the filter. Exits on
+// errors or if no recipe is selected.
+func (o *recipeOptions) recipes(command string, args []string) []dynconf.Recipe {
+	var recipes []dynconf.Recipe
+	if o.all && len(args) == 0 {
+		var err error
+		recipes, err = dynconf.LoadRecipes(dynconf.RecipeDirs, o.filter)
+		if errs, ok := err.(dynconf.Errors); ok {
+			fmt.Fprintf(os.Stderr, "Error loading recipes:\n")
+			for _, e := range errs {
+				fmt.Printf("error: %s\n", e)
+			}
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading recipes: %s\n", err)
+			os.Exit(1)
+		}
+	} else {
+		files := o.files(command, args)
+		recipes = make([]dynconf.Recipe, 0, len(files))
+		for _, file := range files {
+			r, _ := o.readRecipe(file)
+			if o.filter.Match(&r) {
+				recipes = append(recipes, r)
+			}
+		}
+	}
+
+	if len(recipes) == 0 {
+		fmt.Println("No recipes selected.")
+		os.Exit(0)
+	}
+	return recipes
+}
+
+// Sort the recipes and group them by target, exiting on errors.
+func groupTargets(recipes []dynconf.Recipe) []dynconf.Target {
+	targets, err := dynconf.GroupTargets(recipes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error expanding files of recipes: %s\n", err)
+		os.Exit(1)
+	}
+	return targets
+}
+
+// Make c write the configuration file of t with the attributes declared by
+// the recipes, and create it if it does not exist and one of the recipes asks
+// for it. Owner and group are not resolved, see dynconf.FileAttributes.Check.
+// Returns false after printing errors.
+func prepareTarget(c *dynconf.Config, t dynconf.Target) bool {
+	attrs, err := t.Attributes()
+	if err == nil {
+		err = c.Declare(attrs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error declaring attributes of %s: %s\n", t.File, err)
+		return false
+	}
+
+	create, template, err := t.Create()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error preparing to create %s: %s\n", t.File, err)
+		return false
+	} else if create {
+		c.Create(template)
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+func Schema(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Command 'schema' does not take arguments")
+		os.Exit(1)
+	}
+
+	schema, err := dynconf.Schema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating schema: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(schema)
+	os.Exit(0)
+}
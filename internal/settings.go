@@ -0,0 +1,41 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+var settingsFile string
+var prefer string
+var stateDir string
+
+// Register flags for the settings and for finding the input of configuration
+// files.
+func addSettingsFlags(flags *flag.FlagSet) {
+	flags.StringVar(&settingsFile, "settings", dynconf.SettingsFile, "read settings from this file")
+	flags.StringVar(&prefer, "prefer", "", "use this update file if there are several ('newest', 'priority', or the name of a detector)")
+	flags.StringVar(&stateDir, "state-dir", "", "keep unmodified copies of configuration files in this directory (default "+dynconf.DefaultStateDir+")")
+}
+
+// Load and apply the settings, exiting on errors.
+func loadSettings() {
+	s, err := dynconf.LoadSettings(settingsFile)
+	if err == nil {
+		if prefer != "" {
+			s.Prefer = prefer
+		}
+		if stateDir != "" {
+			s.StateDir = stateDir
+		}
+		err = s.Apply()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in settings '%s': %s\n", settingsFile, err)
+		os.Exit(1)
+	}
+}
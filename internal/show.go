@@ -3,6 +3,8 @@
 package internal
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 
@@ -10,41 +12,92 @@ import (
 )
 
 func Show(args []string) {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Command 'show' requires a recipe")
+	var opts recipeOptions
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	opts.addFlags(flags)
+	addSettingsFlags(flags)
+	traceFormat := flags.String("trace", "", "print deletions and replacements to stderr ('text' or 'json')")
+	flags.Parse(args)
+	if *traceFormat != "" && *traceFormat != "text" && *traceFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown trace format: %s\n", *traceFormat)
 		os.Exit(1)
 	}
+	recipes := opts.recipes("show", flags.Args())
+	loadSettings()
 
-	file := args[0]
-	var r dynconf.Recipe
-	err := r.Read(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading recipe '%s': %s\n", file, err)
-		os.Exit(1)
-	}
+	targets := groupTargets(recipes)
 
-	errs, _ := r.Validate()
-	if len(errs) > 0 {
-		fmt.Fprintf(os.Stderr, "Recipe '%s' is invalid:\n", file)
-		for _, e := range errs {
-			fmt.Printf("error: %s\n", e)
+	failed := false
+	for idx, t := range targets {
+		c, err := dynconf.NewConfig(t.File)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding input for %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+		input := c.GetInput()
+		if d := c.Detector(); d != "" {
+			fmt.Fprintf(os.Stderr, "Using update file %s of %s, found by detector '%s'\n", input, t.File, d)
+		}
+		for _, l := range c.Leftovers() {
+			fmt.Fprintf(os.Stderr, "Ignoring update file %s, it will be removed by apply\n", l)
 		}
-		os.Exit(1)
-	}
 
-	c := dynconf.NewConfig(r.File)
-	input := c.GetInput()
+		if !prepareTarget(c, t) {
+			failed = true
+			continue
+		}
+		data, err := c.ReadInput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", input, err)
+			failed = true
+			continue
+		}
 
-	_, content, errs := dynconf.ApplyToFile(r, input)
-	if len(errs) != 0 {
-		fmt.Fprintf(os.Stderr, "Recipe '%s' coult not be applied:\n", file)
-		for _, e := range errs {
-			fmt.Printf("error: %s\n", e)
+		content, trace, errs := dynconf.TraceStackInput(t.Recipes, data)
+		if *traceFormat != "" {
+			printTrace(*traceFormat, t.File, trace)
 		}
+		if len(errs) != 0 {
+			fmt.Fprintf(os.Stderr, "Recipes coult not be applied to %s:\n", t.File)
+			for _, e := range errs {
+				fmt.Printf("error: %s\n", e)
+			}
+			failed = true
+			continue
+		}
+
+		if len(targets) > 1 {
+			// Separate the files with a header, similar to head and tail.
+			if idx > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", t.File)
+		}
+		fmt.Print(string(content))
+	}
+	if failed {
 		os.Exit(1)
 	}
 
-	fmt.Print(string(content))
-
 	os.Exit(0)
 }
+
+func printTrace(format string, file string, trace []dynconf.Event) {
+	if format == "json" {
+		data, _ := json.Marshal(struct {
+			File   string          `json:"file"`
+			Events []dynconf.Event `json:"events"`
+		}{file, trace})
+		fmt.Fprintln(os.Stderr, string(data))
+		return
+	}
+
+	for _, e := range trace {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s by entry '%s'", file, e.Line, e.Action, e.Entry)
+		if e.Recipe != "" {
+			fmt.Fprintf(os.Stderr, " of recipe '%s'", e.Recipe)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+}
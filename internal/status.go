@@ -0,0 +1,91 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hahnjo/dynconf/pkg"
+)
+
+func Status(args []string) {
+	var opts recipeOptions
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	opts.addFlags(flags)
+	addSettingsFlags(flags)
+	reconcile := flags.String("reconcile", "", "reconcile files saved by the package manager ('restore', 'discard', or 'keep')")
+	flags.Parse(args)
+	var policy dynconf.SavePolicy
+	if *reconcile != "" {
+		var err error
+		policy, err = dynconf.ParseSavePolicy(*reconcile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	recipes := opts.recipes("status", flags.Args())
+	loadSettings()
+
+	targets := groupTargets(recipes)
+
+	failed := false
+	for _, t := range targets {
+		c, err := dynconf.NewConfig(t.File)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding input for %s: %s\n", t.File, err)
+			failed = true
+			continue
+		}
+
+		saved := c.Saved()
+		if saved != "" && policy != "" {
+			err = c.Reconcile(policy)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reconciling %s: %s\n", t.File, err)
+				failed = true
+				continue
+			}
+		}
+
+		if saved != "" {
+			switch policy {
+			case dynconf.SaveRestore:
+				fmt.Printf("Restored %s from %s.\n", t.File, saved)
+			case dynconf.SaveDiscard:
+				fmt.Printf("Discarded %s.\n", saved)
+			}
+		}
+
+		// Files that do not exist or wait for reconciliation cannot drift.
+		switch state := c.State(); state {
+		case dynconf.StateMissing, dynconf.StateRemoved, dynconf.StateReinstalled:
+			fmt.Printf("%s: %s\n", t.File, state)
+			if s := c.Saved(); s != "" {
+				fmt.Printf("  saved file %s\n", s)
+			}
+			failed = true
+			continue
+		}
+
+		if !prepareTarget(c, t) {
+			failed = true
+			continue
+		}
+		drift, errs := c.Drift(t.Recipes)
+		fmt.Printf("%s: %s\n", t.File, drift)
+		for _, e := range errs {
+			fmt.Printf("error: %s\n", e)
+		}
+		if drift != dynconf.DriftUpToDate {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
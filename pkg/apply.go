@@ -94,7 +94,30 @@ func applyAppend(r Recipe, modified []byte) []byte {
 	return modified
 }
 
+// Event records that an entry of a recipe deleted or replaced in a line.
+type Event struct {
+	Recipe string `json:"recipe,omitempty"`
+	Entry  string `json:"entry"`
+	Action string `json:"action"`
+	// Line in the input, starting at 1.
+	Line int `json:"line"`
+}
+
 func ApplyToInput(r Recipe, input []byte) ([]byte, []error) {
+	return applyToInput(r, input, nil)
+}
+
+// TraceInput applies the recipe like ApplyToInput and additionally returns
+// all deletions and replacements in the order they happened.
+func TraceInput(r Recipe, input []byte) ([]byte, []Event, []error) {
+	trace := make([]Event, 0)
+	modified, errs := applyToInput(r, input, &trace)
+	return modified, trace, errs
+}
+
+// Apply the recipe to input. If trace is not nil, all deletions and
+// replacements are recorded.
+func applyToInput(r Recipe, input []byte, trace *[]Event) ([]byte, []error) {
 	inLen := len(input)
 
 	deleteActive := []bool(nil)
@@ -123,7 +146,10 @@ func ApplyToInput(r Recipe, input []byte) ([]byte, []error) {
 	modified := make([]byte, 0)
 	// Loop over all lines and modify input.
 	idx := 0
+	lineIdx := -1
 	for idx < inLen {
+		lineIdx++
+
 		// Find the first character that introduces a newline.
 		to := bytes.IndexAny(input[idx:], "\x00\r\n")
 		if to == -1 {
@@ -157,6 +183,9 @@ func ApplyToInput(r Recipe, input []byte) ([]byte, []error) {
 				if r.hasCount {
 					deleteCount[idx]++
 				}
+				if trace != nil {
+					*trace = append(*trace, Event{r.Name, d.label, "delete", lineIdx + 1})
+				}
 				goto next
 			}
 		}
@@ -169,6 +198,9 @@ func ApplyToInput(r Recipe, input []byte) ([]byte, []error) {
 				if r.hasCount {
 					replaceCount[idx] += count
 				}
+				if trace != nil && count > 0 {
+					*trace = append(*trace, Event{r.Name, sr.label, "replace", lineIdx + 1})
+				}
 			}
 		}
 		modified = append(modified, line...)
@@ -185,12 +217,12 @@ func ApplyToInput(r Recipe, input []byte) ([]byte, []error) {
 
 	for idx, d := range r.Delete {
 		if d.CheckCount != 0 && d.CheckCount != deleteCount[idx] {
-			errs = append(errs, fmt.Errorf("Delete pattern '%s' applied %d times, expected %d!", d.Search, deleteCount[idx], d.CheckCount))
+			errs = append(errs, fmt.Errorf("Delete entry '%s' applied %d times, expected %d!", d.label, deleteCount[idx], d.CheckCount))
 		}
 	}
 	for idx, r := range r.Replace {
 		if r.CheckCount != 0 && r.CheckCount != replaceCount[idx] {
-			errs = append(errs, fmt.Errorf("Replace pattern '%s' applied %d times, expected %d!", r.Search, replaceCount[idx], r.CheckCount))
+			errs = append(errs, fmt.Errorf("Replace entry '%s' applied %d times, expected %d!", r.label, replaceCount[idx], r.CheckCount))
 		}
 	}
 
@@ -458,3 +458,63 @@ func TestApply_Newline(t *testing.T) {
 		t.Errorf("newlines should have been copied: %s", s)
 	}
 }
+
+func TestApply_CheckCountLabel(t *testing.T) {
+	r := Recipe{
+		Delete: []DeleteEntry{
+			{Search: "remove", CheckCount: 2},
+		},
+		Replace: []ReplaceEntry{
+			{Search: "search", Replace: "replace"},
+			{ID: "named", Search: "search", Replace: "replace", CheckCount: 2},
+		},
+	}
+	r.Compile()
+
+	_, errs := ApplyToInput(r, []byte("remove\nsearch\n"))
+	if len(errs) != 2 {
+		t.Fatalf("unexpected number of errors: %d\n", len(errs))
+	}
+	if errs[0].Error() != "Delete entry 'delete[0]' applied 1 times, expected 2!" {
+		t.Errorf("unexpected error: %s\n", errs[0])
+	}
+	if errs[1].Error() != "Replace entry 'named' applied 0 times, expected 2!" {
+		t.Errorf("unexpected error: %s\n", errs[1])
+	}
+}
+
+func TestTrace(t *testing.T) {
+	r := Recipe{
+		Name: "trace",
+		Delete: []DeleteEntry{
+			{Search: "remove"},
+		},
+		Replace: []ReplaceEntry{
+			{ID: "first", Search: "search", Replace: "replace"},
+			{Search: "replace", Replace: "again"},
+		},
+	}
+	r.Compile()
+
+	modified, trace, errs := TraceInput(r, []byte("line\nremove\nsearch\n"))
+	if len(errs) != 0 {
+		t.Errorf("did not expect %d errors", len(errs))
+	}
+	if string(modified) != "line\nagain\n" {
+		t.Errorf("recipe should have been applied: %s\n", modified)
+	}
+
+	expected := []Event{
+		{"trace", "delete[0]", "delete", 2},
+		{"trace", "first", "replace", 3},
+		{"trace", "replace[1]", "replace", 3},
+	}
+	if len(trace) != len(expected) {
+		t.Fatalf("unexpected trace: %v\n", trace)
+	}
+	for idx, e := range expected {
+		if trace[idx] != e {
+			t.Errorf("event %d should be %v: %v\n", idx, e, trace[idx])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileAttributes declares the mode and owners of a configuration file. Empty
+// fields are not declared.
+type FileAttributes struct {
+	// Mode as an octal number like "0644".
+	Mode string
+	// Owner and Group by name or numeric id.
+	Owner string
+	Group string
+}
+
+// PasswdFile and GroupFile are the databases to resolve names of owners and
+// groups. They are read directly so that the names are resolved the same way
+// as by the package manager, without services like LDAP.
+var (
+	PasswdFile = "/etc/passwd"
+	GroupFile  = "/etc/group"
+)
+
+var modeRegexp = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// Look up the numeric id of name in filename, which has the format of
+// /etc/passwd or /etc/group: entries of fields separated by colons, with the
+// name in the first and the id in the third field.
+func lookupID(filename string, name string) (int, bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 || fields[0] != name {
+			continue
+		}
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, false, fmt.Errorf("Invalid id '%s' for '%s' in %s!", fields[2], name, filename)
+		}
+		return id, true, nil
+	}
+	return 0, false, scanner.Err()
+}
+
+// Resolve an owner or group by numeric id or name in filename.
+func resolveID(kind string, filename string, value string) (int, error) {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+	id, found, err := lookupID(filename, value)
+	if err != nil {
+		return 0, err
+	} else if !found {
+		return 0, fmt.Errorf("Unknown %s '%s'!", kind, value)
+	}
+	return id, nil
+}
+
+// Resolve the attributes, using defaults for fields that are not declared.
+func (a FileAttributes) resolve(defaults fileAttrs) (fileAttrs, error) {
+	attrs := defaults
+	if a.Mode != "" {
+		if !modeRegexp.MatchString(a.Mode) {
+			return attrs, fmt.Errorf("Invalid mode '%s', expected an octal number like '0644'!", a.Mode)
+		}
+		mode, _ := strconv.ParseUint(a.Mode, 8, 32)
+		attrs.mode = os.FileMode(mode)
+	}
+	var err error
+	if a.Owner != "" {
+		attrs.uid, err = resolveID("owner", PasswdFile, a.Owner)
+		if err != nil {
+			return attrs, err
+		}
+	}
+	if a.Group != "" {
+		attrs.gid, err = resolveID("group", GroupFile, a.Group)
+		if err != nil {
+			return attrs, err
+		}
+	}
+	return attrs, nil
+}
+
+// Check returns an error if the attributes cannot be resolved, for example
+// because the owner or group is unknown.
+func (a FileAttributes) Check() error {
+	_, err := a.resolve(fileAttrs{})
+	return err
+}
+
+// Declare makes Commit write the configuration file with the mode and owners
+// declared in attrs. Attributes that are not declared are kept from the
+// existing file. It is an error if the mode is invalid. Owner and group are
+// only resolved by Commit and Drift, see Check to resolve them beforehand.
+func (c *Config) Declare(attrs FileAttributes) error {
+	_, err := FileAttributes{Mode: attrs.Mode}.resolve(fileAttrs{})
+	if err != nil {
+		return err
+	}
+	c.declared = attrs
+	return nil
+}
+
+// Return the mode and owners to write the configuration file with.
+func (c *Config) attrs() (fileAttrs, error) {
+	defaults := fileAttrs{defaultCreateMode, os.Getuid(), os.Getgid()}
+	if !c.creating() {
+		stat, err := os.Stat(c.base)
+		if err != nil {
+			return fileAttrs{}, err
+		}
+		defaults, err = statAttrs(stat)
+		if err != nil {
+			return fileAttrs{}, err
+		}
+	}
+	return c.declared.resolve(defaults)
+}
+
+// Describe how the attributes of the configuration file differ from the
+// declared ones.
+func (c *Config) attrsDiffer() ([]error, error) {
+	stat, err := os.Stat(c.base)
+	if err != nil {
+		return nil, err
+	}
+	current, err := statAttrs(stat)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := c.declared.resolve(current)
+	if err != nil {
+		return nil, err
+	}
+
+	differ := make([]error, 0)
+	if current.mode != expected.mode {
+		differ = append(differ, fmt.Errorf("Mode is %04o, expected %04o!", current.mode, expected.mode))
+	}
+	if current.uid != expected.uid {
+		differ = append(differ, fmt.Errorf("Owner is %d, expected %d!", current.uid, expected.uid))
+	}
+	if current.gid != expected.gid {
+		differ = append(differ, fmt.Errorf("Group is %d, expected %d!", current.gid, expected.gid))
+	}
+	return differ, nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// Use passwd and group files in dir with the users and groups "root" and
+// "test".
+func useUserDatabase(t *testing.T, dir string) func() {
+	passwd, group := PasswdFile, GroupFile
+	PasswdFile = path.Join(dir, "passwd")
+	GroupFile = path.Join(dir, "group")
+	writeTempFile(t, PasswdFile, []byte("root:x:0:0::/root:/bin/bash\n# comment\ntest:x:1000:1000::/home/test:/bin/sh\n"))
+	writeTempFile(t, GroupFile, []byte("root:x:0:\ntest:x:1001:\n"))
+	return func() {
+		PasswdFile, GroupFile = passwd, group
+	}
+}
+
+func TestFileAttributes_Resolve(t *testing.T) {
+	dir, _ := createTempFiles(t, "resolve", nil)
+	defer os.RemoveAll(dir)
+	defer useUserDatabase(t, dir)()
+
+	defaults := fileAttrs{0644, 1, 2}
+	for a, expected := range map[FileAttributes]fileAttrs{
+		{}:                                    defaults,
+		{Mode: "600", Owner: "0", Group: "0"}: {0600, 0, 0},
+		{Mode: "0755", Owner: "test", Group: "test"}: {0755, 1000, 1001},
+		{Owner: "root"}: {0644, 0, 2},
+	} {
+		attrs, err := a.resolve(defaults)
+		if err != nil || attrs != expected {
+			t.Errorf("unexpected attributes for %v: %v %v\n", a, attrs, err)
+		}
+	}
+
+	for a, msg := range map[FileAttributes]string{
+		{Mode: "0800"}:     "Invalid mode '0800', expected an octal number like '0644'!",
+		{Owner: "missing"}: "Unknown owner 'missing'!",
+		{Group: "missing"}: "Unknown group 'missing'!",
+	} {
+		_, err := a.resolve(defaults)
+		if err == nil || err.Error() != msg {
+			t.Errorf("unexpected error for %v: %v\n", a, err)
+		}
+	}
+
+	os.Remove(PasswdFile)
+	_, err := FileAttributes{Owner: "root"}.resolve(defaults)
+	if err == nil {
+		t.Errorf("resolving without passwd file should fail\n")
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	dir, filenames := createTempFiles(t, "declare", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	os.Chmod(base, 0644)
+
+	c := newConfig(t, base)
+	err := c.Declare(FileAttributes{Mode: "0640", Group: "nonexistent-group"})
+	if err != nil {
+		t.Errorf("declaring unknown group should only fail on commit: %s\n", err)
+	}
+	err = c.Commit(origData, modifiedData)
+	if err == nil || err.Error() != "Unknown group 'nonexistent-group'!" {
+		t.Errorf("committing with unknown group should fail: %v\n", err)
+	}
+	if exists(base + ".orig") {
+		t.Errorf("unmodified copy should not be written with unknown group\n")
+	}
+	err = FileAttributes{Group: "nonexistent-group"}.Check()
+	if err == nil {
+		t.Errorf("checking unknown group should fail\n")
+	}
+	err = c.Declare(FileAttributes{Mode: "0999"})
+	if err == nil {
+		t.Errorf("declaring invalid mode should fail\n")
+	}
+	err = c.Declare(FileAttributes{Mode: "0640"})
+	if err != nil {
+		t.Fatalf("could not declare attributes: %s\n", err)
+	}
+	commit(t, c)
+
+	stat, err := os.Stat(base)
+	if err != nil || stat.Mode() != 0640 {
+		t.Errorf("mode should be enforced: %v %v\n", stat, err)
+	}
+	stat, err = os.Stat(base + ".orig")
+	if err != nil || stat.Mode() != 0640 {
+		t.Errorf("mode of unmodified copy should be enforced: %v %v\n", stat, err)
+	}
+
+	// The mode is enforced again, even if the recipes do not change the
+	// content.
+	os.Chmod(base, 0666)
+	c = newConfig(t, base)
+	c.Declare(FileAttributes{Mode: "0640"})
+	commit(t, c)
+	stat, err = os.Stat(base)
+	if err != nil || stat.Mode() != 0640 {
+		t.Errorf("mode should be enforced again: %v %v\n", stat, err)
+	}
+}
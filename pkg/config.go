@@ -3,46 +3,264 @@
 package dynconf
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	base string
-	orig *string
-	new  *string
+	base     string
+	origFile string
+	orig     *string
+	new      *string
+	detector Detector
+	// File saved by the package manager on removal or reinstallation.
+	saved *string
+	// Update files found in addition to new, removed on Commit.
+	leftovers []string
+	// Hash of the recipes for the history.
+	recipeHash string
+	// Create the file from template if it does not exist.
+	create   bool
+	template []byte
+	// Mode and owners declared by the recipes.
+	declared FileAttributes
+}
+
+// DefaultStateDir is the state directory if none is configured in the
+// settings.
+const DefaultStateDir = "/var/lib/dynconf"
+
+// StateDir is the directory where DynConf keeps the unmodified copies of
+// configuration files, in the subdirectory "orig" under their absolute path.
+// If empty, they are stored next to the configuration files with the suffix
+// ".orig".
+var StateDir = ""
+
+// Return the path for filename in the subdirectory kind of the state
+// directory.
+func inStateDir(kind string, filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(StateDir, kind, abs), nil
 }
 
 func (c *Config) getOrig() string {
-	return c.base + ".orig"
+	return c.origFile
 }
 
 func (c *Config) findOrig() {
 	orig := c.getOrig()
+	if !exists(orig) {
+		// Fall back to a copy next to the configuration file that was
+		// created before the state directory was configured.
+		orig = c.base + ".orig"
+	}
 	if exists(orig) {
 		c.orig = &orig
 	}
 }
 
-var newSuffixes = []string{
-	".pacnew", // pacman (Arch Linux)
-	".rpmnew", // rpm (RHEL, Fedora)
+// Make orig the unmodified copy, removing a copy next to the configuration
+// file that it replaces.
+func (c *Config) setOrig(orig string) error {
+	if c.orig != nil && *c.orig != orig {
+		err := os.Remove(*c.orig)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	c.orig = &orig
+	return nil
+}
+
+// Write the unmodified copy with the file mode and owners attrs.
+func (c *Config) writeOrig(data []byte, attrs fileAttrs) error {
+	orig := c.getOrig()
+	err := os.MkdirAll(filepath.Dir(orig), 0755)
+	if err != nil {
+		return err
+	}
+	err = writeFileAttrs(orig, data, attrs)
+	if err != nil {
+		return err
+	}
+	return c.setOrig(orig)
+}
+
+// Check if filename was created by DynConf or a package manager and is thus
+// not a configuration file on its own.
+func isAuxiliary(filename string) bool {
+	if strings.HasSuffix(filename, ".orig") {
+		return true
+	}
+	if strings.HasPrefix(filepath.Base(filename), ".dynconf.") {
+		return true
+	}
+	for _, d := range Detectors {
+		if d.Matches(filename) {
+			return true
+		}
+	}
+	for _, d := range SaveDetectors {
+		if d.Matches(filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// An update file found by a detector.
+type candidate struct {
+	filename string
+	detector Detector
+	modTime  time.Time
+}
+
+// Choose the update file to use according to Prefer. candidates must be in
+// the order of Detectors. Without a preference, all candidates must be found
+// by the same detector.
+func chooseUpdate(candidates []candidate) (candidate, error) {
+	switch Prefer {
+	case "":
+		// Without a preference, refuse to remove the update file of
+		// another package manager.
+		for _, c := range candidates[1:] {
+			if c.detector != candidates[0].detector {
+				files := make([]string, 0, len(candidates))
+				for _, c := range candidates {
+					files = append(files, c.filename)
+				}
+				return candidate{}, fmt.Errorf("Update files %s were found by several detectors, choose one with --prefer!", strings.Join(files, ", "))
+			}
+		}
+	case PreferNewest:
+	case PreferPriority:
+		return candidates[0], nil
+	default:
+		for _, c := range candidates {
+			if c.detector.Name() == Prefer {
+				return c, nil
+			}
+		}
+	}
+
+	newest := candidates[0]
+	ambiguous := make([]string, 0)
+	for _, c := range candidates[1:] {
+		if c.modTime.After(newest.modTime) {
+			newest = c
+			ambiguous = ambiguous[:0]
+		} else if c.modTime.Equal(newest.modTime) {
+			ambiguous = append(ambiguous, c.filename)
+		}
+	}
+	if len(ambiguous) > 0 && Prefer == "" {
+		files := append([]string{newest.filename}, ambiguous...)
+		return candidate{}, fmt.Errorf("Update files %s were modified at the same time, choose one with --prefer!", strings.Join(files, ", "))
+	}
+	return newest, nil
 }
 
-func (c *Config) findNew() {
-	for _, suffix := range newSuffixes {
-		newFilename := c.base + suffix
-		if exists(newFilename) {
-			c.new = &newFilename
-			return
+func (c *Config) findNew() error {
+	candidates := make([]candidate, 0)
+	for _, d := range Detectors {
+		for _, filename := range d.Find(c.base) {
+			stat, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, candidate{filename, d, stat.ModTime()})
+		}
+		if s, ok := d.(superseder); ok {
+			c.leftovers = append(c.leftovers, s.Superseded(c.base)...)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	chosen, err := chooseUpdate(candidates)
+	if err != nil {
+		return err
+	}
+	c.new = &chosen.filename
+	c.detector = chosen.detector
+	for _, other := range candidates {
+		if other.filename != chosen.filename {
+			c.leftovers = append(c.leftovers, other.filename)
 		}
 	}
+	return nil
 }
 
-func NewConfig(filename string) *Config {
-	c := Config{base: filename}
+// NewConfig finds the input for the configuration file filename. It is an
+// error if there are several update files and none can be chosen, see Prefer.
+func NewConfig(filename string) (*Config, error) {
+	c := Config{base: filename, origFile: filename + ".orig"}
+	if StateDir != "" {
+		var err error
+		c.origFile, err = inStateDir("orig", filename)
+		if err != nil {
+			return nil, err
+		}
+	}
 	c.findOrig()
-	c.findNew()
-	return &c
+	c.findSaved()
+	err := c.findNew()
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// MigrateOrig moves the unmodified copy of the configuration file filename
+// from next to it into StateDir. It returns the new location, or the empty
+// string if there is no copy to move.
+func MigrateOrig(filename string) (string, error) {
+	if StateDir == "" {
+		return "", fmt.Errorf("There is no state directory to move into!")
+	}
+	legacy := filename + ".orig"
+	if !exists(legacy) {
+		return "", nil
+	}
+
+	orig, err := inStateDir("orig", filename)
+	if err != nil {
+		return "", err
+	}
+	if exists(orig) {
+		return "", fmt.Errorf("Cannot move %s, %s already exists!", legacy, orig)
+	}
+	err = os.MkdirAll(filepath.Dir(orig), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = moveFile(legacy, orig)
+	if err != nil {
+		return "", err
+	}
+	return orig, nil
+}
+
+// Leftovers returns the update files that are not used as input. They are
+// removed on Commit.
+func (c *Config) Leftovers() []string {
+	return c.leftovers
+}
+
+// Detector returns the name of the detector that found the update file used
+// as input, or the empty string if there is none.
+func (c *Config) Detector() string {
+	if c.new == nil {
+		return ""
+	}
+	return c.detector.Name()
 }
 
 func (c *Config) GetInput() string {
@@ -57,23 +275,47 @@ func (c *Config) GetInput() string {
 }
 
 func (c *Config) Commit(origData []byte, modified []byte) error {
-	// Get FileInfo of the configuration file.
-	stat, err := os.Stat(c.base)
+	return c.commit(origData, modified, modified)
+}
+
+// CommitMerged is like Commit, but writes merged, the output of the recipes
+// with manual edits merged into it, see Merge. The configuration file is
+// still considered edited afterwards, so the manual edits are merged again on
+// the next update.
+func (c *Config) CommitMerged(origData []byte, modified []byte, merged []byte) error {
+	return c.commit(origData, modified, merged)
+}
+
+// Write data to the configuration file, which is the output of the recipes
+// modified by manual edits.
+func (c *Config) commit(origData []byte, modified []byte, data []byte) error {
+	// Get mode and owners of the configuration file.
+	attrs, err := c.attrs()
 	if err != nil {
 		return err
 	}
 
+	if c.creating() {
+		// Create missing parent directories before writing anything.
+		err = os.MkdirAll(filepath.Dir(c.base), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
 	if c.new == nil && c.orig == nil {
 		// Copy the unmodified file to allow idempotence.
-		origFile := c.getOrig()
-		c.orig = &origFile
-		err = writeFile(origFile, origData, stat)
+		err = c.writeOrig(origData, attrs)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = writeFile(c.base, modified, stat)
+	err = writeFileAttrs(c.base, data, attrs)
+	if err != nil {
+		return err
+	}
+	err = c.recordOutput(modified)
 	if err != nil {
 		return err
 	}
@@ -81,8 +323,15 @@ func (c *Config) Commit(origData []byte, modified []byte) error {
 	if c.new != nil {
 		// Move the new file to allow idempotence.
 		orig := c.getOrig()
-		c.orig = &orig
-		err = os.Rename(*c.new, orig)
+		err = os.MkdirAll(filepath.Dir(orig), 0755)
+		if err != nil {
+			return err
+		}
+		err = moveFile(*c.new, orig)
+		if err != nil {
+			return err
+		}
+		err = c.setOrig(orig)
 		if err != nil {
 			return err
 		}
@@ -91,5 +340,14 @@ func (c *Config) Commit(origData []byte, modified []byte) error {
 		c.new = nil
 	}
 
-	return nil
+	// Remove other updates, they would be used as input next time.
+	for _, filename := range c.leftovers {
+		err = os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	c.leftovers = nil
+
+	return c.record(origData, data)
 }
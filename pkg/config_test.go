@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func createTempFiles(t *testing.T, prefix string, files []string) (string, []string) {
@@ -44,6 +45,14 @@ var oldOrigData = []byte("old-orig")
 var modifiedData = []byte("modified")
 var newData = []byte("new")
 
+func newConfig(t *testing.T, base string) *Config {
+	c, err := NewConfig(base)
+	if err != nil {
+		t.Fatalf("could not find input: %s\n", err)
+	}
+	return c
+}
+
 func commit(t *testing.T, c *Config) {
 	err := c.Commit(origData, modifiedData)
 	if err != nil {
@@ -67,7 +76,7 @@ func TestBase(t *testing.T) {
 	defer os.RemoveAll(dir)
 	base := filenames[0]
 
-	c := NewConfig(base)
+	c := newConfig(t, base)
 	i := c.GetInput()
 	if i != base {
 		t.Errorf("getInput should return base: %s\n", i)
@@ -89,7 +98,7 @@ func TestOrig(t *testing.T) {
 	orig := filenames[1]
 	writeTempFile(t, orig, oldOrigData)
 
-	c := NewConfig(base)
+	c := newConfig(t, base)
 	i := c.GetInput()
 	if i != orig {
 		t.Errorf("getInput should return .orig: %s\n", i)
@@ -113,7 +122,7 @@ func testNew(t *testing.T, newSuffix string) {
 	pacnew := filenames[2]
 	writeTempFile(t, pacnew, newData)
 
-	c := NewConfig(base)
+	c := newConfig(t, base)
 	i := c.GetInput()
 	if i != pacnew {
 		t.Errorf("getInput should return .%s: %s\n", newSuffix, i)
@@ -135,6 +144,205 @@ func TestRpmnew(t *testing.T) {
 	testNew(t, "rpmnew")
 }
 
+func TestDpkgDist(t *testing.T) {
+	testNew(t, "dpkg-dist")
+}
+
+func TestDpkgNew(t *testing.T) {
+	testNew(t, "dpkg-new")
+}
+
+func TestUcfDist(t *testing.T) {
+	testNew(t, "ucf-dist")
+}
+
+func TestApkNew(t *testing.T) {
+	testNew(t, "apk-new")
+}
+
+func TestGentoo(t *testing.T) {
+	dir, filenames := createTempFiles(t, "gentoo", []string{
+		"test.conf",
+		"test.conf.orig",
+		"._cfg0000_test.conf",
+		"._cfg0002_test.conf",
+		"._cfg0001_test.conf",
+		"._cfg0003_other.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	orig := filenames[1]
+	writeTempFile(t, orig, oldOrigData)
+	newest := filenames[3]
+	writeTempFile(t, newest, newData)
+
+	c := newConfig(t, base)
+	i := c.GetInput()
+	if i != newest {
+		t.Errorf("getInput should return the highest-numbered ._cfg file: %s\n", i)
+	}
+	if d := c.Detector(); d != "gentoo" {
+		t.Errorf("update file should be found by gentoo: %s\n", d)
+	}
+
+	commit(t, c)
+	checkContent(t, base, modifiedData)
+	checkContent(t, orig, newData)
+	for _, filename := range filenames[2:5] {
+		if exists(filename) {
+			t.Errorf("%s should have been deleted\n", filename)
+		}
+	}
+	if !exists(filenames[5]) {
+		t.Errorf("update file of other.conf should not be deleted\n")
+	}
+	if !isAuxiliary(filenames[5]) {
+		t.Errorf("._cfg files should be auxiliary\n")
+	}
+}
+
+// Create update files with increasing modification times.
+func createUpdates(t *testing.T, prefix string, updates []string) (string, []string) {
+	dir, filenames := createTempFiles(t, prefix, append([]string{"test.conf"}, updates...))
+	now := time.Now()
+	for idx, filename := range filenames[1:] {
+		mtime := now.Add(time.Duration(idx-len(updates)) * time.Minute)
+		err := os.Chtimes(filename, mtime, mtime)
+		if err != nil {
+			t.Errorf("could not change times of %s: %s\n", filename, err)
+		}
+	}
+	return dir, filenames
+}
+
+func TestDetector(t *testing.T) {
+	dir, filenames := createUpdates(t, "detector", []string{
+		"test.conf.dpkg-dist",
+		"test.conf.rpmnew",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+
+	// Update files of different package managers are not removed without a
+	// preference.
+	_, err := NewConfig(base)
+	expected := "Update files " + filenames[2] + ", " + filenames[1] + " were found by several detectors, choose one with --prefer!"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+
+	defer func(prefer string) {
+		Prefer = prefer
+	}(Prefer)
+	Prefer = PreferNewest
+	c := newConfig(t, base)
+	if i := c.GetInput(); i != filenames[2] {
+		t.Errorf("getInput should return the newest file .rpmnew: %s\n", i)
+	}
+	if d := c.Detector(); d != "rpm" {
+		t.Errorf("update file should be found by rpm: %s\n", d)
+	}
+	if l := c.Leftovers(); len(l) != 1 || l[0] != filenames[1] {
+		t.Errorf(".dpkg-dist should be a leftover: %v\n", l)
+	}
+
+	commit(t, c)
+	if d := c.Detector(); d != "" {
+		t.Errorf("there should be no update file after commit: %s\n", d)
+	}
+	if exists(filenames[1]) {
+		t.Errorf("leftover should have been deleted\n")
+	}
+}
+
+func TestDetector_Prefer(t *testing.T) {
+	dir, filenames := createUpdates(t, "detector_prefer", []string{
+		"test.conf.dpkg-dist",
+		"test.conf.rpmnew",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+
+	defer func(prefer string) {
+		Prefer = prefer
+	}(Prefer)
+	for prefer, expected := range map[string]string{
+		PreferNewest:   filenames[2],
+		PreferPriority: filenames[2],
+		"dpkg":         filenames[1],
+		"pacman":       filenames[2],
+	} {
+		Prefer = prefer
+		c := newConfig(t, base)
+		if i := c.GetInput(); i != expected {
+			t.Errorf("getInput should return %s when preferring %s: %s\n", expected, prefer, i)
+		}
+	}
+
+	// Make .dpkg-dist the newest file.
+	now := time.Now()
+	os.Chtimes(filenames[1], now, now)
+	Prefer = PreferPriority
+	c := newConfig(t, base)
+	if i := c.GetInput(); i != filenames[2] {
+		t.Errorf("getInput should return .rpmnew of the detector with higher priority: %s\n", i)
+	}
+}
+
+func TestDetector_Ambiguous(t *testing.T) {
+	dir, filenames := createTempFiles(t, "detector_ambiguous", []string{
+		"test.conf",
+		"test.conf.dpkg-dist",
+		"test.conf.dpkg-new",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	mtime := time.Now()
+	for _, filename := range filenames[1:] {
+		os.Chtimes(filename, mtime, mtime)
+	}
+
+	_, err := NewConfig(base)
+	expected := "Update files " + filenames[1] + ", " + filenames[2] + " were modified at the same time, choose one with --prefer!"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+
+	defer func(prefer string) {
+		Prefer = prefer
+	}(Prefer)
+	Prefer = PreferNewest
+	c := newConfig(t, base)
+	if i := c.GetInput(); i != filenames[1] {
+		t.Errorf("getInput should return the preferred file .dpkg-dist: %s\n", i)
+	}
+}
+
+func TestDetector_Prefix(t *testing.T) {
+	dir, filenames := createTempFiles(t, "detector_prefix", []string{
+		"test.conf",
+		".new.test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+
+	defer func(detectors []Detector) {
+		Detectors = detectors
+	}(Detectors)
+	Detectors = []Detector{NewPrefixDetector("prefix", ".new.")}
+
+	c := newConfig(t, base)
+	if i := c.GetInput(); i != filenames[1] {
+		t.Errorf("getInput should return the prefixed file: %s\n", i)
+	}
+	if d := c.Detector(); d != "prefix" {
+		t.Errorf("update file should be found by prefix: %s\n", d)
+	}
+	if !isAuxiliary(filenames[1]) {
+		t.Errorf("prefixed file should be auxiliary\n")
+	}
+}
+
 func TestNew_Unrecognized(t *testing.T) {
 	dir, filenames := createTempFiles(t, "new_unrecognized", []string{
 		"test.conf",
@@ -143,7 +351,7 @@ func TestNew_Unrecognized(t *testing.T) {
 	defer os.RemoveAll(dir)
 	base := filenames[0]
 
-	c := NewConfig(base)
+	c := newConfig(t, base)
 	i := c.GetInput()
 	if i != base {
 		t.Errorf("getInput should return base: %s\n", i)
@@ -160,7 +368,7 @@ func testNew_NoOrig(t *testing.T, newSuffix string) {
 	pacnew := filenames[1]
 	writeTempFile(t, pacnew, newData)
 
-	c := NewConfig(base)
+	c := newConfig(t, base)
 	i := c.GetInput()
 	if i != pacnew {
 		t.Errorf("getInput should return .%s: %s\n", newSuffix, i)
@@ -182,3 +390,110 @@ func testPacnew_NoOrig(t *testing.T) {
 func testRpmnew_NoOrig(t *testing.T) {
 	testNew_NoOrig(t, "rpmnew")
 }
+
+// Use a temporary state directory and return it with a function to restore
+// the previous one.
+func useStateDir(t *testing.T) (string, func()) {
+	stateDir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s\n", err)
+	}
+	previous := StateDir
+	StateDir = stateDir
+	return stateDir, func() {
+		StateDir = previous
+		os.RemoveAll(stateDir)
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	dir, filenames := createTempFiles(t, "statedir", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	stateDir, restore := useStateDir(t)
+	defer restore()
+	orig := path.Join(stateDir, "orig", base)
+
+	c := newConfig(t, base)
+	commit(t, c)
+	checkContent(t, orig, origData)
+	if exists(base + ".orig") {
+		t.Errorf(".orig should not be created next to the configuration file\n")
+	}
+
+	c = newConfig(t, base)
+	if i := c.GetInput(); i != orig {
+		t.Errorf("getInput should return the copy in the state directory: %s\n", i)
+	}
+
+	writeTempFile(t, base+".pacnew", newData)
+	c = newConfig(t, base)
+	commit(t, c)
+	checkContent(t, orig, newData)
+	if exists(base + ".pacnew") {
+		t.Errorf(".pacnew should have been moved\n")
+	}
+}
+
+func TestStateDir_Legacy(t *testing.T) {
+	dir, filenames := createTempFiles(t, "statedir_legacy", []string{
+		"test.conf",
+		"test.conf.orig",
+		"test.conf.pacnew",
+	})
+	defer os.RemoveAll(dir)
+	base, legacy := filenames[0], filenames[1]
+	writeTempFile(t, legacy, oldOrigData)
+	writeTempFile(t, filenames[2], newData)
+	stateDir, restore := useStateDir(t)
+	defer restore()
+
+	c := newConfig(t, base)
+	checkState(t, c, StateUpdate)
+	commit(t, c)
+	checkContent(t, path.Join(stateDir, "orig", base), newData)
+	if exists(legacy) {
+		t.Errorf("outdated .orig should have been deleted\n")
+	}
+}
+
+func TestMigrateOrig(t *testing.T) {
+	dir, filenames := createTempFiles(t, "migrate_orig", []string{
+		"test.conf",
+		"test.conf.orig",
+		"other.conf",
+	})
+	defer os.RemoveAll(dir)
+	base, legacy := filenames[0], filenames[1]
+	writeTempFile(t, legacy, oldOrigData)
+
+	_, err := MigrateOrig(base)
+	if err == nil {
+		t.Errorf("migrating without state directory should fail\n")
+	}
+
+	stateDir, restore := useStateDir(t)
+	defer restore()
+	orig := path.Join(stateDir, "orig", base)
+	moved, err := MigrateOrig(base)
+	if err != nil || moved != orig {
+		t.Errorf("unexpected result: %s %v\n", moved, err)
+	}
+	checkContent(t, orig, oldOrigData)
+	if exists(legacy) {
+		t.Errorf(".orig should have been moved\n")
+	}
+
+	moved, err = MigrateOrig(filenames[2])
+	if err != nil || moved != "" {
+		t.Errorf("there should be nothing to migrate: %s %v\n", moved, err)
+	}
+
+	writeTempFile(t, legacy, oldOrigData)
+	_, err = MigrateOrig(base)
+	if err == nil {
+		t.Errorf("migrating should not overwrite the copy in the state directory\n")
+	}
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"io/ioutil"
+)
+
+// The mode of created files if none is declared.
+const defaultCreateMode = 0644
+
+// Create makes Commit create the configuration file if it does not exist, with
+// template as the input. Unless declared with Declare, the file is created
+// with mode 0644 and owned by the current user.
+func (c *Config) Create(template []byte) {
+	c.create = true
+	c.template = template
+}
+
+// Check if the configuration file will be created from the template.
+func (c *Config) creating() bool {
+	return c.create && c.new == nil && c.orig == nil && !exists(c.base)
+}
+
+// ReadInput returns the contents of the input, see GetInput, or the template
+// if the configuration file will be created.
+func (c *Config) ReadInput() ([]byte, error) {
+	if c.creating() {
+		return c.template, nil
+	}
+	return ioutil.ReadFile(c.GetInput())
+}
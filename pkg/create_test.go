@@ -0,0 +1,114 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "create")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	base := path.Join(dir, "test.conf")
+	template := []byte("template\n")
+
+	c := newConfig(t, base)
+	c.Create(template)
+	err = c.Declare(FileAttributes{Mode: "0600"})
+	if err != nil {
+		t.Fatalf("could not declare attributes: %s\n", err)
+	}
+	input, err := c.ReadInput()
+	if err != nil || string(input) != string(template) {
+		t.Errorf("input should be the template: %s %v\n", input, err)
+	}
+
+	err = c.Commit(input, modifiedData)
+	if err != nil {
+		t.Fatalf("could not commit: %s\n", err)
+	}
+	checkContent(t, base, modifiedData)
+	checkContent(t, base+".orig", template)
+	stat, err := os.Stat(base)
+	if err != nil || stat.Mode() != 0600 {
+		t.Errorf("file should be created with mode 0600: %v %v\n", stat, err)
+	}
+
+	// Once the file exists, the template is not used anymore.
+	c = newConfig(t, base)
+	c.Create([]byte("changed"))
+	input, err = c.ReadInput()
+	if err != nil || string(input) != string(template) {
+		t.Errorf("input should be the unmodified copy: %s %v\n", input, err)
+	}
+}
+
+func TestCreate_MissingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "create_missing")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s\n", err)
+	}
+	defer os.RemoveAll(dir)
+	base := path.Join(dir, "sub", "dir", "test.conf")
+
+	c := newConfig(t, base)
+	c.Create([]byte("template\n"))
+	err = c.Commit([]byte("template\n"), modifiedData)
+	if err != nil {
+		t.Fatalf("could not commit: %s\n", err)
+	}
+	checkContent(t, base, modifiedData)
+	stat, err := os.Stat(path.Dir(base))
+	if err != nil || !stat.IsDir() {
+		t.Errorf("parent directory should be created: %v %v\n", stat, err)
+	}
+}
+
+func TestCreate_Exists(t *testing.T) {
+	dir, filenames := createTempFiles(t, "create_exists", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	writeTempFile(t, base, origData)
+
+	c := newConfig(t, base)
+	c.Create([]byte("template"))
+	input, err := c.ReadInput()
+	if err != nil || string(input) != string(origData) {
+		t.Errorf("input should be the existing file: %s %v\n", input, err)
+	}
+}
+
+func TestTarget_Create(t *testing.T) {
+	target := Target{File: "/etc/test.conf", Recipes: []Recipe{
+		{Name: "a", Mode: "0600"},
+		{Name: "b", Create: true, Template: "template", Owner: strconv.Itoa(os.Getuid())},
+		{Name: "c", Mode: "0600"},
+	}}
+	create, template, err := target.Create()
+	if err != nil || !create || string(template) != "template" {
+		t.Errorf("unexpected result: %v %s %v\n", create, template, err)
+	}
+	attrs, err := target.Attributes()
+	if err != nil || attrs.Mode != "0600" || attrs.Owner == "" || attrs.Group != "" {
+		t.Errorf("unexpected attributes: %v %v\n", attrs, err)
+	}
+
+	target.Recipes = append(target.Recipes, Recipe{Name: "d", Template: "other", Mode: "0644"})
+	_, _, err = target.Create()
+	if err == nil || err.Error() != "Recipes 'b' and 'd' declare different templates for /etc/test.conf!" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+	_, err = target.Attributes()
+	if err == nil || err.Error() != "Recipes 'c' and 'd' declare different mode for /etc/test.conf!" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
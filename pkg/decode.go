@@ -0,0 +1,332 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a location in a recipe file. Line and Column are zero if the
+// location is unknown, for example for recipes that were not read from a file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return p.File
+	} else if p.Column == 0 {
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// RecipeError is an error concerning a specific field of a recipe. Path names
+// the field, for example "replace[2].search".
+type RecipeError struct {
+	Position Position
+	Path     string
+	Msg      string
+}
+
+func (e *RecipeError) Error() string {
+	parts := make([]string, 0, 3)
+	if pos := e.Position.String(); pos != "" {
+		parts = append(parts, pos)
+	}
+	if e.Path != "" {
+		parts = append(parts, e.Path)
+	}
+	parts = append(parts, e.Msg)
+	return strings.Join(parts, ": ")
+}
+
+// Errors is a list of all errors found in a recipe.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Positions of the fields of a recipe or an entry, indexed by their path
+// relative to the recipe or entry. The empty path is the start of the entry.
+type positions map[string]Position
+
+// Return the position of field, falling back to the start of the entry.
+func (p positions) get(field string) Position {
+	if pos, ok := p[field]; ok {
+		return pos
+	}
+	return p[""]
+}
+
+func (p positions) clone() positions {
+	c := make(positions, len(p))
+	for k, v := range p {
+		c[k] = v
+	}
+	return c
+}
+
+// Replace the positions of key and all nested fields by those in src.
+func (p positions) override(src positions, key string) {
+	isNested := func(k string) bool {
+		return k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(k, key+"[")
+	}
+	for k := range p {
+		if isNested(k) {
+			delete(p, k)
+		}
+	}
+	for k, v := range src {
+		if isNested(k) {
+			p[k] = v
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Return the name that a struct field is decoded from.
+func fieldKey(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
+
+func isInline(f reflect.StructField) bool {
+	for _, flag := range strings.Split(f.Tag.Get("yaml"), ",")[1:] {
+		if flag == "inline" {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the field of a struct type that is decoded from key, looking into
+// inlined structs.
+func structField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isInline(f) {
+			if inner, ok := structField(f.Type, key); ok {
+				return inner, true
+			}
+			continue
+		}
+		if f.PkgPath != "" || f.Tag.Get("yaml") == "-" {
+			// Unexported or ignored field.
+			continue
+		}
+		if fieldKey(f) == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Find the value of key in a mapping node.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+// Decodes recipes from yaml.Node, keeping track of positions and collecting
+// all errors. Recipes in all formats are parsed into yaml.Node.
+type nodeDecoder struct {
+	file   string
+	format RecipeFormat
+	errs   Errors
+}
+
+func (d *nodeDecoder) position(n *yaml.Node) Position {
+	return Position{d.file, n.Line, n.Column}
+}
+
+func (d *nodeDecoder) errorf(n *yaml.Node, path string, format string, args ...interface{}) {
+	d.errs = append(d.errs, &RecipeError{d.position(n), path, fmt.Sprintf(format, args...)})
+}
+
+// Check that n can be decoded into a value of type t, reporting unknown
+// fields and nodes of the wrong kind.
+func (d *nodeDecoder) check(n *yaml.Node, t reflect.Type, path string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if isNull(n) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			d.errorf(n, path, "Expected a mapping!")
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Tag == "!!merge" {
+				d.check(value, t, path)
+				continue
+			}
+			f, ok := structField(t, key.Value)
+			if !ok {
+				d.errorf(key, path, "Unknown field '%s'!", key.Value)
+				continue
+			}
+			d.check(value, f.Type, joinPath(path, key.Value))
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			d.errorf(n, path, "Expected a list!")
+			return
+		}
+		for i, item := range n.Content {
+			d.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+
+	case reflect.Int:
+		if n.Kind != yaml.ScalarNode || n.ShortTag() != "!!int" {
+			d.errorf(n, path, "Expected an integer!")
+		}
+
+	default:
+		if n.Kind != yaml.ScalarNode {
+			d.errorf(n, path, "Expected a single value!")
+		}
+	}
+}
+
+// Decode n into out, converting type errors to include the file.
+func (d *nodeDecoder) decode(n *yaml.Node, out interface{}) {
+	err := n.Decode(out)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		for _, e := range typeErr.Errors {
+			// The messages have the form "line N: ...".
+			var line int
+			var msg string
+			if _, scanErr := fmt.Sscanf(e, "line %d:", &line); scanErr == nil {
+				msg = strings.TrimSpace(e[strings.Index(e, ":")+1:])
+			} else {
+				msg = e
+			}
+			d.errs = append(d.errs, &RecipeError{Position{File: d.file, Line: line}, "", msg})
+		}
+	} else if err != nil {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", err.Error()})
+	}
+}
+
+// Record the positions of n and all values nested in mappings. For lists,
+// only the positions of the items are recorded.
+func (d *nodeDecoder) positions(n *yaml.Node, path string, pos positions) {
+	pos[path] = d.position(n)
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			d.positions(n.Content[i+1], joinPath(path, n.Content[i].Value), pos)
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			pos[fmt.Sprintf("%s[%d]", path, i)] = d.position(item)
+		}
+	}
+}
+
+// Parse data into a YAML document node with exactly one root node.
+func (d *nodeDecoder) parseYAML(data []byte) *yaml.Node {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", err.Error()})
+		return nil
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", "Recipe is empty!"})
+		return nil
+	}
+	return &doc
+}
+
+// Parse data in the format of the decoder into a document node with exactly
+// one root node.
+func (d *nodeDecoder) parseDocument(data []byte) *yaml.Node {
+	switch d.format {
+	case FormatJSON:
+		return d.parseJSON(data)
+	case FormatTOML:
+		return d.parseTOML(data)
+	}
+	return d.parseYAML(data)
+}
+
+// Parse data into the root node of a document.
+func (d *nodeDecoder) parse(data []byte) *yaml.Node {
+	doc := d.parseDocument(data)
+	if doc == nil {
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// Decode a recipe file from its root node, recording the positions of all
+// fields and entries.
+func (d *nodeDecoder) decodeRecipe(root *yaml.Node) (recipeFile, bool) {
+	var rf recipeFile
+	d.check(root, reflect.TypeOf(rf), "")
+	if len(d.errs) > 0 {
+		return rf, false
+	}
+
+	d.decode(root, &rf)
+	if len(d.errs) > 0 {
+		return rf, false
+	}
+
+	rf.pos = make(positions)
+	d.positions(root, "", rf.pos)
+	if deletes := mappingValue(root, "delete"); deletes != nil && deletes.Kind == yaml.SequenceNode {
+		for idx, item := range deletes.Content {
+			rf.Delete[idx].pos = make(positions)
+			d.positions(item, "", rf.Delete[idx].pos)
+		}
+	}
+	if replaces := mappingValue(root, "replace"); replaces != nil && replaces.Kind == yaml.SequenceNode {
+		for idx, item := range replaces.Content {
+			rf.Replace[idx].pos = make(positions)
+			d.positions(item, "", rf.Replace[idx].pos)
+		}
+	}
+
+	return rf, true
+}
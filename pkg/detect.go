@@ -0,0 +1,215 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Detector finds the files that a package manager creates next to a
+// configuration file when an update changes its default contents.
+type Detector interface {
+	// Name identifies the detector in the settings and in messages.
+	Name() string
+	// Find returns the update files for the configuration file base that
+	// exist, the preferred one first.
+	Find(base string) []string
+	// Matches checks if filename is an update file of some configuration
+	// file.
+	Matches(filename string) bool
+}
+
+// Implemented by detectors whose update files supersede each other. Superseded
+// returns the update files that are outdated by the one returned by Find.
+type superseder interface {
+	Superseded(base string) []string
+}
+
+// Detects update files named like the configuration file with a suffix.
+type suffixDetector struct {
+	name     string
+	suffixes []string
+}
+
+// NewSuffixDetector returns a Detector for update files named like the
+// configuration file with one of suffixes appended, for example ".pacnew".
+func NewSuffixDetector(name string, suffixes ...string) Detector {
+	return &suffixDetector{name, suffixes}
+}
+
+func (d *suffixDetector) Name() string {
+	return d.name
+}
+
+func (d *suffixDetector) Find(base string) []string {
+	found := make([]string, 0)
+	for _, suffix := range d.suffixes {
+		if filename := base + suffix; exists(filename) {
+			found = append(found, filename)
+		}
+	}
+	return found
+}
+
+func (d *suffixDetector) Matches(filename string) bool {
+	for _, suffix := range d.suffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Detects update files in the same directory as the configuration file, named
+// like it with a prefix.
+type prefixDetector struct {
+	name     string
+	prefixes []string
+}
+
+// NewPrefixDetector returns a Detector for update files in the directory of
+// the configuration file, named like it with one of prefixes prepended.
+func NewPrefixDetector(name string, prefixes ...string) Detector {
+	return &prefixDetector{name, prefixes}
+}
+
+func (d *prefixDetector) Name() string {
+	return d.name
+}
+
+func (d *prefixDetector) Find(base string) []string {
+	dir, file := filepath.Split(base)
+	found := make([]string, 0)
+	for _, prefix := range d.prefixes {
+		if filename := filepath.Join(dir, prefix+file); exists(filename) {
+			found = append(found, filename)
+		}
+	}
+	return found
+}
+
+func (d *prefixDetector) Matches(filename string) bool {
+	file := filepath.Base(filename)
+	for _, prefix := range d.prefixes {
+		if strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Detects the update files of Gentoo's etc-update and dispatch-conf, named
+// like "._cfg0000_name" in the same directory with increasing numbers.
+type gentooDetector struct{}
+
+var gentooRegexp = regexp.MustCompile(`^\._cfg([0-9]{4})_`)
+
+func (d gentooDetector) Name() string {
+	return "gentoo"
+}
+
+// Return all update files, the one with the highest number first.
+func (d gentooDetector) findAll(base string) []string {
+	dir, file := filepath.Split(base)
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "."))
+	if err != nil {
+		return nil
+	}
+
+	found := make([]string, 0)
+	numbers := make(map[string]int)
+	for _, e := range entries {
+		m := gentooRegexp.FindStringSubmatch(e.Name())
+		if m == nil || e.Name()[len(m[0]):] != file {
+			continue
+		}
+		filename := filepath.Join(dir, e.Name())
+		numbers[filename], _ = strconv.Atoi(m[1])
+		found = append(found, filename)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return numbers[found[i]] > numbers[found[j]]
+	})
+	return found
+}
+
+// Find returns the update file with the highest number.
+func (d gentooDetector) Find(base string) []string {
+	found := d.findAll(base)
+	if len(found) > 1 {
+		return found[:1]
+	}
+	return found
+}
+
+// Superseded returns the update files with lower numbers.
+func (d gentooDetector) Superseded(base string) []string {
+	found := d.findAll(base)
+	if len(found) > 1 {
+		return found[1:]
+	}
+	return nil
+}
+
+func (d gentooDetector) Matches(filename string) bool {
+	return gentooRegexp.MatchString(filepath.Base(filename))
+}
+
+// KnownDetectors contains all detectors that can be enabled by name in the
+// settings. Programs using this package may register additional detectors.
+var KnownDetectors = map[string]Detector{
+	"pacman": NewSuffixDetector("pacman", ".pacnew"),               // Arch Linux
+	"rpm":    NewSuffixDetector("rpm", ".rpmnew"),                  // RHEL, Fedora
+	"dpkg":   NewSuffixDetector("dpkg", ".dpkg-dist", ".dpkg-new"), // Debian, Ubuntu
+	"ucf":    NewSuffixDetector("ucf", ".ucf-dist"),                // Debian, Ubuntu
+	"apk":    NewSuffixDetector("apk", ".apk-new"),                 // Alpine Linux
+	"gentoo": gentooDetector{},                                     // Gentoo
+}
+
+// DefaultDetectors lists the names of the detectors that are enabled without
+// settings, in order of priority.
+var DefaultDetectors = []string{
+	"pacman",
+	"rpm",
+	"dpkg",
+	"ucf",
+	"apk",
+	"gentoo",
+}
+
+// Detectors lists the enabled detectors in order of priority.
+var Detectors = defaultDetectors()
+
+// SaveDetectors find the files that a package manager leaves behind when it
+// removes or reinstalls a package whose configuration file was modified.
+var SaveDetectors = []Detector{
+	NewSuffixDetector("pacman", ".pacsave"), // Arch Linux
+	NewSuffixDetector("rpm", ".rpmsave"),    // RHEL, Fedora
+}
+
+const (
+	// Use the most recently modified update file.
+	PreferNewest = "newest"
+	// Use the update file found by the first detector in Detectors.
+	PreferPriority = "priority"
+)
+
+// Prefer decides which update file is used as input if there are several:
+// PreferNewest, PreferPriority, or the name of a detector to use its file. If
+// empty, it is an error if several detectors found update files, and the most
+// recently modified file of one detector is used unless that is ambiguous. All
+// other update files are removed on Commit.
+var Prefer = ""
+
+func defaultDetectors() []Detector {
+	detectors := make([]Detector, 0, len(DefaultDetectors))
+	for _, name := range DefaultDetectors {
+		detectors = append(detectors, KnownDetectors[name])
+	}
+	return detectors
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// An edit turning the lines a into b. For diffEqual, a and b are the indices
+// of the line in both. Otherwise, one of them is the index of the deleted or
+// inserted line and the other one is the position in the other side.
+type diffEdit struct {
+	op   diffOp
+	a, b int
+}
+
+// Split data into lines, keeping the line endings.
+func splitLines(data []byte) []string {
+	lines := make([]string, 0)
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			idx = len(data) - 1
+		}
+		lines = append(lines, string(data[:idx+1]))
+		data = data[idx+1:]
+	}
+	return lines
+}
+
+// Compute the shortest edit script turning a into b with Myers' algorithm.
+func diffLines(a []string, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max
+	v := make([]int, 2*max+2)
+	trace := make([][]int, 0)
+
+	var d int
+search:
+	for d = 0; d <= max; d++ {
+		// Step d only reads the diagonals -d to d from the previous step, so
+		// keep just these for walking back.
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the trace, collecting the edits in reverse.
+	edits := make([]diffEdit, 0, max)
+	x, y := n, m
+	for ; d > 0; d-- {
+		// The saved diagonals of step d start at -d.
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, diffEdit{diffEqual, x, y})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, diffEdit{diffInsert, x, y})
+		} else {
+			x--
+			edits = append(edits, diffEdit{diffDelete, x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, diffEdit{diffEqual, x, y})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// Number of unchanged lines around changes in Diff.
+const diffContext = 3
+
+// Format the range of a hunk, starting at the index start.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Diff returns the changes from the data named fromName to the data named
+// toName in unified format, or nil if they are equal.
+func Diff(fromName string, from []byte, toName string, to []byte) []byte {
+	a, b := splitLines(from), splitLines(to)
+	edits := diffLines(a, b)
+
+	var buf bytes.Buffer
+	writeLine := func(prefix string, line string) {
+		buf.WriteString(prefix)
+		buf.WriteString(line)
+		if line[len(line)-1] != '\n' {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	for start := 0; start < len(edits); {
+		// Find the next change and the end of its hunk.
+		first := start
+		for first < len(edits) && edits[first].op == diffEqual {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		end, equal := first, 0
+		for idx := first; idx < len(edits) && equal <= 2*diffContext; idx++ {
+			if edits[idx].op == diffEqual {
+				equal++
+			} else {
+				end, equal = idx+1, 0
+			}
+		}
+		begin := first - diffContext
+		if begin < start {
+			begin = start
+		}
+		stop := end + diffContext
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		countA, countB := 0, 0
+		for _, e := range edits[begin:stop] {
+			if e.op != diffInsert {
+				countA++
+			}
+			if e.op != diffDelete {
+				countB++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(edits[begin].a, countA), hunkRange(edits[begin].b, countB))
+		for _, e := range edits[begin:stop] {
+			switch e.op {
+			case diffEqual:
+				writeLine(" ", a[e.a])
+			case diffDelete:
+				writeLine("-", a[e.a])
+			case diffInsert:
+				writeLine("+", b[e.b])
+			}
+		}
+		start = stop
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
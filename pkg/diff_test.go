@@ -0,0 +1,33 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, test := range []struct {
+		from, to, expected string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\nc\n", "a\nB\nc\n", "--- from\n+++ to\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"", "a\n", "--- from\n+++ to\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\n", "a", "--- from\n+++ to\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"--- from\n+++ to\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n",
+			"0\n1\n2\n3\n4\n5\n6\n",
+			"--- from\n+++ to\n@@ -1,7 +1,7 @@\n+0\n 1\n 2\n 3\n 4\n 5\n 6\n-7\n",
+		},
+	} {
+		d := Diff("from", []byte(test.from), "to", []byte(test.to))
+		if string(d) != test.expected {
+			t.Errorf("unexpected diff of '%s' and '%s':\n%s", test.from, test.to, d)
+		}
+	}
+}
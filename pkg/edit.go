@@ -0,0 +1,102 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Return the file with the output of the recipes that was written last.
+func (c *Config) outputFile() (string, error) {
+	return inStateDir("written", c.base)
+}
+
+// Record the output of the recipes written to the configuration file, and its
+// hash to detect manual edits.
+func (c *Config) recordOutput(output []byte) error {
+	if StateDir == "" {
+		return nil
+	}
+	filename, err := c.outputFile()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, output, 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename+".sha256", []byte(hashData(output)+"\n"), 0644)
+}
+
+// Return the recorded hash, or the empty string if there is none.
+func (c *Config) recordedHash() (string, error) {
+	if StateDir == "" {
+		return "", nil
+	}
+	filename, err := c.outputFile()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filename + ".sha256")
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Edited checks if the configuration file was modified since DynConf wrote it
+// last. Without a state directory, before the first Commit, or if the file
+// was deleted, it is never considered edited.
+func (c *Config) Edited() (bool, error) {
+	hash, err := c.recordedHash()
+	if err != nil || hash == "" {
+		return false, err
+	}
+	current, err := ioutil.ReadFile(c.base)
+	if os.IsNotExist(err) {
+		// There are no edits to lose.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return hashData(current) != hash, nil
+}
+
+// LastOutput returns the output of the recipes that DynConf wrote last, or nil
+// if it is not known.
+func (c *Config) LastOutput() ([]byte, error) {
+	hash, err := c.recordedHash()
+	if err != nil || hash == "" {
+		return nil, err
+	}
+	filename, err := c.outputFile()
+	if err != nil {
+		return nil, err
+	}
+	output, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if hashData(output) != hash {
+		return nil, nil
+	}
+	return output, nil
+}
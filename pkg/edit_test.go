@@ -0,0 +1,104 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func checkEdited(t *testing.T, c *Config, expected bool) {
+	edited, err := c.Edited()
+	if err != nil {
+		t.Fatalf("could not check for edits: %s\n", err)
+	}
+	if edited != expected {
+		t.Errorf("edited should be %v\n", expected)
+	}
+}
+
+func TestEdited(t *testing.T) {
+	dir, filenames := createTempFiles(t, "edited", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+
+	// Without state directory, there is nothing to compare with.
+	c := newConfig(t, base)
+	commit(t, c)
+	writeTempFile(t, base, []byte("edited"))
+	checkEdited(t, c, false)
+
+	_, restore := useStateDir(t)
+	defer restore()
+	c = newConfig(t, base)
+	checkEdited(t, c, false)
+	commit(t, c)
+	checkEdited(t, c, false)
+
+	writeTempFile(t, base, []byte("edited"))
+	checkEdited(t, c, true)
+	last, err := c.LastOutput()
+	if err != nil || string(last) != string(modifiedData) {
+		t.Errorf("unexpected last output: %s %v\n", last, err)
+	}
+
+	commit(t, c)
+	checkEdited(t, c, false)
+}
+
+func TestLastOutput_NoHistory(t *testing.T) {
+	dir, filenames := createTempFiles(t, "last_output", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	stateDir, restore := useStateDir(t)
+	defer restore()
+	defer func(generations int) {
+		Generations = generations
+	}(Generations)
+	Generations = 0
+
+	c := newConfig(t, base)
+	commit(t, c)
+	writeTempFile(t, base, []byte("edited"))
+	checkEdited(t, c, true)
+	last, err := c.LastOutput()
+	if err != nil || string(last) != string(modifiedData) {
+		t.Errorf("unexpected last output: %s %v\n", last, err)
+	}
+
+	os.Remove(path.Join(stateDir, "written", base))
+	checkEdited(t, c, true)
+	last, err = c.LastOutput()
+	if err != nil || last != nil {
+		t.Errorf("there should be no last output: %s %v\n", last, err)
+	}
+}
+
+func TestCommitMerged(t *testing.T) {
+	dir, filenames := createTempFiles(t, "commit_merged", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	_, restore := useStateDir(t)
+	defer restore()
+
+	c := newConfig(t, base)
+	err := c.CommitMerged(origData, modifiedData, []byte("merged"))
+	if err != nil {
+		t.Fatalf("could not commit: %s\n", err)
+	}
+	checkContent(t, base, []byte("merged"))
+
+	// The merged modifications are still edits of the output.
+	checkEdited(t, c, true)
+	last, err := c.LastOutput()
+	if err != nil || string(last) != string(modifiedData) {
+		t.Errorf("unexpected last output: %s %v\n", last, err)
+	}
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A recipe as written in a file, possibly extending another recipe.
+type recipeFile struct {
+	Recipe  `yaml:",inline"`
+	Extends string   `yaml:"extends,omitempty"`
+	Remove  []string `yaml:"remove,omitempty"`
+}
+
+// Implemented by DeleteEntry and ReplaceEntry to merge positions.
+type entry interface {
+	fieldPositions() *positions
+}
+
+// Keys of a recipe that are not inherited from the base recipe.
+var notInherited = map[string]bool{
+	"name": true,
+}
+
+// Copy all fields of src that are set in the mapping node n to dst, recursing
+// into nested structs.
+func copyFields(dst, src reflect.Value, n *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		f, ok := structField(dst.Type(), key)
+		if !ok {
+			continue
+		}
+		d, s := dst.FieldByIndex(f.Index), src.FieldByIndex(f.Index)
+
+		if value.Kind == yaml.MappingNode && d.Kind() == reflect.Struct {
+			copyFields(d, s, value)
+		} else {
+			d.Set(s)
+		}
+	}
+}
+
+// Merge lists of entries: Entries of the child override the fields of the
+// inherited entry with the same id, all other entries are appended. n is the
+// sequence node of the child's entries.
+func mergeEntries(base, child reflect.Value, n *yaml.Node) reflect.Value {
+	merged := reflect.MakeSlice(base.Type(), 0, base.Len()+child.Len())
+	merged = reflect.AppendSlice(merged, base)
+
+	for i := 0; i < child.Len(); i++ {
+		e := child.Index(i)
+		id := e.FieldByName("ID").String()
+
+		overridden := false
+		if id != "" {
+			for j := 0; j < merged.Len(); j++ {
+				target := merged.Index(j)
+				if target.FieldByName("ID").String() != id {
+					continue
+				}
+
+				item := n.Content[i]
+				if item.Kind == yaml.AliasNode {
+					item = item.Alias
+				}
+				copyFields(target, e, item)
+
+				pos := target.Addr().Interface().(entry).fieldPositions()
+				src := e.Addr().Interface().(entry).fieldPositions()
+				*pos = pos.clone()
+				for k := 0; k+1 < len(item.Content); k += 2 {
+					pos.override(*src, item.Content[k].Value)
+				}
+
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = reflect.Append(merged, e)
+		}
+	}
+
+	return merged
+}
+
+// Remove the inherited entry with id, returning false if there is none.
+func removeEntry(r *Recipe, id string) bool {
+	found := false
+
+	deletes := make([]DeleteEntry, 0, len(r.Delete))
+	for _, d := range r.Delete {
+		if d.ID == id {
+			found = true
+		} else {
+			deletes = append(deletes, d)
+		}
+	}
+	replaces := make([]ReplaceEntry, 0, len(r.Replace))
+	for _, rs := range r.Replace {
+		if rs.ID == id {
+			found = true
+		} else {
+			replaces = append(replaces, rs)
+		}
+	}
+
+	r.Delete, r.Replace = deletes, replaces
+	return found
+}
+
+// Merge a recipe with the recipe it extends. The mapping node root of the
+// child is used to determine which keys are set.
+func mergeRecipes(base Recipe, child recipeFile, root *yaml.Node) (Recipe, error) {
+	merged := base
+	merged.pos = base.pos.clone()
+	dst := reflect.ValueOf(&merged).Elem()
+	for key := range notInherited {
+		f, _ := structField(dst.Type(), key)
+		d := dst.FieldByIndex(f.Index)
+		d.Set(reflect.Zero(d.Type()))
+	}
+
+	errs := make(Errors, 0)
+	for idx, id := range child.Remove {
+		if !removeEntry(&merged, id) {
+			path := fmt.Sprintf("remove[%d]", idx)
+			errs = append(errs, &RecipeError{child.pos.get(path), path, fmt.Sprintf("Cannot remove entry '%s', no inherited entry has this id!", id)})
+		}
+	}
+	if len(errs) > 0 {
+		return Recipe{}, errs
+	}
+
+	src := reflect.ValueOf(child.Recipe)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		f, ok := structField(dst.Type(), key)
+		if !ok {
+			// Only used for resolving.
+			continue
+		}
+		d, s := dst.FieldByIndex(f.Index), src.FieldByIndex(f.Index)
+
+		if d.Kind() == reflect.Slice && d.Type().Elem().Kind() == reflect.Struct && value.Kind == yaml.SequenceNode {
+			d.Set(mergeEntries(d, s, value))
+		} else {
+			d.Set(s)
+		}
+		merged.pos.override(child.pos, key)
+	}
+
+	return merged, nil
+}
+
+// Decode a recipe from data in format and resolve the recipe it extends,
+// relative to dir. The result is not compiled. seen contains the absolute
+// paths of all recipes that extend this one.
+func decodeExtended(filename string, dir string, format RecipeFormat, data []byte, seen map[string]bool) (Recipe, error) {
+	d := nodeDecoder{file: filename, format: format}
+	root := d.parse(data)
+	if root == nil {
+		return Recipe{}, d.errs
+	}
+	d.migrate(root)
+	if len(d.errs) > 0 {
+		return Recipe{}, d.errs
+	}
+	child, ok := d.decodeRecipe(root)
+	if !ok {
+		return Recipe{}, d.errs
+	}
+
+	if child.Extends == "" {
+		if len(child.Remove) > 0 {
+			return Recipe{}, &RecipeError{child.pos.get("remove"), "remove", "Cannot remove entries without 'extends'!"}
+		}
+		return child.Recipe, nil
+	}
+
+	base := child.Extends
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(dir, base)
+	}
+	abs, err := filepath.Abs(base)
+	if err != nil {
+		return Recipe{}, &RecipeError{child.pos.get("extends"), "extends", err.Error()}
+	}
+	if seen[abs] {
+		return Recipe{}, &RecipeError{child.pos.get("extends"), "extends", fmt.Sprintf("Recipe '%s' extends itself cyclically!", base)}
+	}
+	seen[abs] = true
+
+	baseData, err := ioutil.ReadFile(base)
+	if err != nil {
+		return Recipe{}, &RecipeError{child.pos.get("extends"), "extends", err.Error()}
+	}
+	baseRecipe, err := decodeExtended(base, filepath.Dir(base), FormatOf(base), baseData, seen)
+	if err != nil {
+		return Recipe{}, err
+	}
+
+	return mergeRecipes(baseRecipe, child, root)
+}
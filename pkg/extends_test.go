@@ -0,0 +1,233 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+const baseRecipe = `
+name: "base"
+file: "/etc/test.conf"
+tags: ["base"]
+
+delete:
+  -
+    id: "comments"
+    search: "^#"
+  -
+    search: "remove"
+
+replace:
+  -
+    id: "port"
+    context:
+      begin: "begin"
+      end: "end"
+    search: "Port .*"
+    replace: "Port 22"
+    checkCount: 1
+  -
+    id: "unused"
+    search: "pattern"
+    replace: "substitution"
+
+append: "base"`
+
+func writeRecipes(t *testing.T, recipes map[string]string) string {
+	dir, err := ioutil.TempDir("", "extends")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s\n", err)
+	}
+
+	for name, recipe := range recipes {
+		err = ioutil.WriteFile(path.Join(dir, name), []byte(recipe), 0644)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("could not write %s: %s\n", name, err)
+		}
+	}
+
+	return dir
+}
+
+func TestRead_Extends(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml": baseRecipe,
+		"host.yml": `
+extends: "base.yml"
+remove: ["unused"]
+
+delete:
+  -
+    search: "host"
+
+replace:
+  -
+    id: "port"
+    context:
+      end: "stop"
+    replace: "Port 2222"
+
+append: "y"`,
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.Read(path.Join(dir, "host.yml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+
+	if r.Name != "host" {
+		t.Errorf("name should not be inherited: %s\n", r.Name)
+	}
+	if r.File != "/etc/test.conf" {
+		t.Errorf("file should be inherited: %s\n", r.File)
+	} else if len(r.Tags) != 1 || r.Tags[0] != "base" {
+		t.Errorf("tags should be inherited: %v\n", r.Tags)
+	}
+
+	if len(r.Delete) != 3 {
+		t.Fatalf("wrong number of delete entries: %d\n", len(r.Delete))
+	}
+	if r.Delete[0].ID != "comments" || r.Delete[1].Search != "remove" || r.Delete[2].Search != "host" {
+		t.Errorf("delete entries were not merged correctly: %v\n", r.Delete)
+	}
+
+	if len(r.Replace) != 1 {
+		t.Fatalf("wrong number of replace entries: %d\n", len(r.Replace))
+	}
+	rs := r.Replace[0]
+	if rs.ID != "port" || rs.Search != "Port .*" || rs.Replace != "Port 2222" || rs.CheckCount != 1 {
+		t.Errorf("replace entry was not overridden correctly: %v\n", rs)
+	} else if rs.Context.Begin != "begin" || rs.Context.End != "stop" || rs.Context.EndRegexp.String() != "stop" {
+		t.Errorf("context was not overridden correctly: %v\n", rs.Context)
+	}
+
+	if r.Append != "y" {
+		t.Errorf("append should be overridden: %s\n", r.Append)
+	}
+}
+
+func TestRead_ExtendsChain(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml":   baseRecipe,
+		"middle.yml": "extends: 'base.yml'\nfile: '/etc/middle.conf'",
+		"host.yml":   "extends: 'middle.yml'\nremove: ['comments']",
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.Read(path.Join(dir, "host.yml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+
+	if r.File != "/etc/middle.conf" {
+		t.Errorf("file should be inherited from middle: %s\n", r.File)
+	} else if len(r.Delete) != 1 || len(r.Replace) != 2 {
+		t.Errorf("entries should be inherited from base: %v %v\n", r.Delete, r.Replace)
+	}
+}
+
+func TestRead_ExtendsErrors(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml":    baseRecipe,
+		"a.yml":       "extends: 'b.yml'",
+		"b.yml":       "extends: 'a.yml'",
+		"missing.yml": "extends: 'missing-base.yml'",
+		"unknown.yml": "extends: 'base.yml'\nremove: ['unknown']",
+		"noBase.yml":  "file: '/etc/test.conf'\nremove: ['comments']",
+		"strict.yml":  "extends: 'base.yml'\nunknown: 'key'",
+	})
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.yml", "missing.yml", "unknown.yml", "noBase.yml", "strict.yml"} {
+		var r Recipe
+		err := r.Read(path.Join(dir, name))
+		if err == nil {
+			t.Errorf("reading %s should fail\n", name)
+		}
+	}
+}
+
+func TestEncode_Extends(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml": baseRecipe,
+		"host.yml": "extends: 'base.yml'\nremove: ['port']",
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.Read(path.Join(dir, "host.yml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+
+	var buf bytes.Buffer
+	err = r.Encode(&buf)
+	if err != nil {
+		t.Fatalf("could not encode recipe: %s\n", err)
+	}
+
+	effective := path.Join(dir, "effective.yml")
+	writeRecipeFile(t, effective, buf.Bytes())
+	var e Recipe
+	err = e.Read(effective)
+	if err != nil {
+		t.Fatalf("could not read effective recipe: %s\n%s", err, buf.Bytes())
+	}
+
+	if e.Name != "host" || e.File != r.File || e.Append != r.Append {
+		t.Errorf("effective recipe does not match: %s\n", buf.Bytes())
+	} else if len(e.Delete) != 2 || len(e.Replace) != 1 || e.Replace[0].ID != "unused" {
+		t.Errorf("effective recipe does not match: %s\n", buf.Bytes())
+	}
+}
+
+func TestRead_ExtendsPositions(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml": `
+delete:
+  -
+    id: "first"
+    search: "("
+  -
+    id: "second"
+    search: "remove"`,
+		"host.yml": `
+extends: "base.yml"
+remove: ["unknown"]`,
+		"override.yml": `
+extends: "base.yml"
+delete:
+  -
+    id: "second"
+    search: "["`,
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	host := path.Join(dir, "host.yml")
+	err := r.Read(host)
+	if err == nil || err.Error() != host+":3:10: remove[0]: Cannot remove entry 'unknown', no inherited entry has this id!" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+
+	override := path.Join(dir, "override.yml")
+	err = r.Read(override)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors: %v\n", err)
+	}
+	checkErrors(t, errs, []string{
+		path.Join(dir, "base.yml") + ":5:13: first.search: error parsing regexp: missing closing ): `(`",
+		override + ":6:13: second.search: error parsing regexp: missing closing ]: `[`",
+		override + ": file: Cannot have empty filename!",
+	})
+}
@@ -4,9 +4,31 @@ package dynconf
 
 import (
 	"os"
+	"path"
 )
 
+// Xattrs lists the extended attributes that are copied from the original file
+// when DynConf replaces a file, as patterns like "user.*". This includes POSIX
+// ACLs ("system.posix_acl_access"), SELinux labels ("security.selinux"), and
+// file capabilities ("security.capability"). By default, all are copied.
+var Xattrs = []string{"*"}
+
+// Check if the extended attribute name should be copied, see Xattrs.
+func copyXattr(name string) bool {
+	for _, pattern := range Xattrs {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
 func exists(filename string) bool {
 	_, err := os.Stat(filename)
 	return err == nil
 }
+
+func isDir(filename string) bool {
+	stat, err := os.Stat(filename)
+	return err == nil && stat.IsDir()
+}
@@ -5,9 +5,12 @@
 package dynconf
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 )
 
@@ -27,19 +30,89 @@ func writeData(file *os.File, data []byte) error {
 	return nil
 }
 
-// Apply file mode and file owners.
-func applyStat(file *os.File, stat os.FileInfo) error {
-	err := file.Chmod(stat.Mode())
+// Mode and owners of a file.
+type fileAttrs struct {
+	mode     os.FileMode
+	uid, gid int
+}
+
+// Return the mode and owners of the file described by stat.
+func statAttrs(stat os.FileInfo) (fileAttrs, error) {
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileAttrs{}, fmt.Errorf("can not get owner of %s\n", stat.Name())
+	}
+	return fileAttrs{stat.Mode(), int(sys.Uid), int(sys.Gid)}, nil
+}
+
+// Return the names of the extended attributes of filename. If the file system
+// does not support them, there are none.
+func listXattrs(filename string) ([]string, error) {
+	size, err := syscall.Listxattr(filename, nil)
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	} else if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(filename, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// The names are terminated by null bytes.
+	names := strings.Split(string(buf[:size]), "\x00")
+	return names[:len(names)-1], nil
+}
+
+// Copy the extended attributes of src that match Xattrs to dst.
+func copyXattrs(src string, dst string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !copyXattr(name) {
+			continue
+		}
+		size, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, size)
+		size, err = syscall.Getxattr(src, name, value)
+		if err != nil {
+			return err
+		}
+		err = syscall.Setxattr(dst, name, value[:size], 0)
+		if errors.Is(err, syscall.ENOTSUP) {
+			// The file system of dst does not support this attribute.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Apply file owners, the extended attributes of the file xattrsFrom (if not
+// empty), and file mode. The owners are changed first because that clears
+// file capabilities, and the mode last because it must win over the mask of
+// an ACL.
+func applyAttrs(file *os.File, attrs fileAttrs, xattrsFrom string) error {
+	err := file.Chown(attrs.uid, attrs.gid)
 	if err != nil {
 		return err
 	}
 
-	sys, ok := stat.Sys().(*syscall.Stat_t)
-	if !ok {
-		return fmt.Errorf("can not get owner of %s\n", stat.Name())
+	if xattrsFrom != "" && exists(xattrsFrom) {
+		err = copyXattrs(xattrsFrom, file.Name())
+		if err != nil {
+			return err
+		}
 	}
-	uid, gid := int(sys.Uid), int(sys.Gid)
-	err = file.Chown(uid, gid)
+
+	err = file.Chmod(attrs.mode)
 	if err != nil {
 		return err
 	}
@@ -48,6 +121,22 @@ func applyStat(file *os.File, stat os.FileInfo) error {
 }
 
 func writeFile(filename string, data []byte, stat os.FileInfo) error {
+	attrs, err := statAttrs(stat)
+	if err != nil {
+		return err
+	}
+	return writeFileAttrs(filename, data, attrs)
+}
+
+// Write data to filename with attrs, keeping the extended attributes of the
+// file that is replaced.
+func writeFileAttrs(filename string, data []byte, attrs fileAttrs) error {
+	return writeFileFrom(filename, data, attrs, filename)
+}
+
+// Write data to filename with attrs and the extended attributes of the file
+// xattrsFrom.
+func writeFileFrom(filename string, data []byte, attrs fileAttrs, xattrsFrom string) error {
 	var err error
 
 	dir, file := path.Split(filename)
@@ -67,12 +156,12 @@ func writeFile(filename string, data []byte, stat os.FileInfo) error {
 	}
 	defer os.Remove(tmpFilename)
 
-	// Write data and apply file mode as well as file owners.
+	// Write data and apply file mode, file owners, and extended attributes.
 	err = writeData(f, data)
 	if err != nil {
 		return err
 	}
-	err = applyStat(f, stat)
+	err = applyAttrs(f, attrs, xattrsFrom)
 	if err != nil {
 		return err
 	}
@@ -91,3 +180,36 @@ func writeFile(filename string, data []byte, stat os.FileInfo) error {
 
 	return nil
 }
+
+// Move src to dst, copying the data if they are on different file systems.
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	err = copyFile(src, dst)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Copy the data, mode, and owners of src to dst. The extended attributes are
+// not copied, so dst gets the default ones of its location, for example the
+// security label of the state directory.
+func copyFile(src string, dst string) error {
+	stat, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	attrs, err := statAttrs(stat)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileFrom(dst, data, attrs, "")
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// Set the extended attribute name of filename, skipping the test if the file
+// system does not support user attributes.
+func setXattr(t *testing.T, filename string, name string, value string) {
+	err := syscall.Setxattr(filename, name, []byte(value), 0)
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skipf("file system does not support extended attributes: %s\n", err)
+	} else if err != nil {
+		t.Fatalf("could not set %s of %s: %s\n", name, filename, err)
+	}
+}
+
+func checkXattr(t *testing.T, filename string, name string, expected string) {
+	value := make([]byte, 64)
+	size, err := syscall.Getxattr(filename, name, value)
+	if expected == "" {
+		if !errors.Is(err, syscall.ENODATA) {
+			t.Errorf("%s of %s should not exist: %v\n", name, filename, err)
+		}
+	} else if err != nil || string(value[:size]) != expected {
+		t.Errorf("%s of %s should be '%s': %s %v\n", name, filename, expected, value[:size], err)
+	}
+}
+
+func TestWriteFile_Xattrs(t *testing.T) {
+	dir, filenames := createTempFiles(t, "xattrs", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	setXattr(t, base, "user.keep", "value")
+	setXattr(t, base, "user.other", "other")
+
+	c := newConfig(t, base)
+	commit(t, c)
+	checkContent(t, base, modifiedData)
+	checkXattr(t, base, "user.keep", "value")
+	checkXattr(t, base, "user.other", "other")
+
+	defer func(xattrs []string) {
+		Xattrs = xattrs
+	}(Xattrs)
+	Xattrs = []string{"user.k*"}
+	stat, err := os.Stat(base)
+	if err != nil {
+		t.Fatalf("could not stat %s: %s\n", base, err)
+	}
+	err = writeFile(base, origData, stat)
+	if err != nil {
+		t.Fatalf("could not write %s: %s\n", base, err)
+	}
+	checkXattr(t, base, "user.keep", "value")
+	checkXattr(t, base, "user.other", "")
+
+	Xattrs = nil
+	err = writeFile(base, origData, stat)
+	if err != nil {
+		t.Fatalf("could not write %s: %s\n", base, err)
+	}
+	checkXattr(t, base, "user.keep", "")
+}
+
+func TestMoveFile_Xattrs(t *testing.T) {
+	dir, filenames := createTempFiles(t, "move_xattrs", []string{
+		"src.conf", "dst.conf", "copy.conf",
+	})
+	defer os.RemoveAll(dir)
+	src, dst, cp := filenames[0], filenames[1], filenames[2]
+	writeTempFile(t, src, origData)
+	setXattr(t, src, "user.keep", "value")
+
+	// Copying between file systems does not take the extended attributes.
+	err := copyFile(src, cp)
+	if err != nil {
+		t.Fatalf("could not copy %s: %s\n", src, err)
+	}
+	checkContent(t, cp, origData)
+	checkXattr(t, cp, "user.keep", "")
+
+	err = moveFile(src, dst)
+	if err != nil {
+		t.Fatalf("could not move %s: %s\n", src, err)
+	}
+	checkContent(t, dst, origData)
+	checkXattr(t, dst, "user.keep", "value")
+	if exists(src) {
+		t.Errorf("%s should not exist after moving\n", src)
+	}
+}
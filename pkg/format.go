@@ -0,0 +1,255 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Return the keys of a struct type in the order of declaration, including the
+// keys of inlined structs.
+func fieldOrder(t reflect.Type) []string {
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isInline(f) {
+			keys = append(keys, fieldOrder(f.Type)...)
+		} else if f.PkgPath == "" && f.Tag.Get("yaml") != "-" {
+			keys = append(keys, fieldKey(f))
+		}
+	}
+	return keys
+}
+
+// Sort the pairs of the mapping node n by the declaration order in t. Keys that
+// are not declared, for example in older versions of the format, keep their
+// order after all declared keys.
+func sortKeys(n *yaml.Node, t reflect.Type) {
+	// The version determines how to read the rest of the recipe, followed by
+	// the recipe that it extends and the entries removed from it.
+	leading := []string{"version", "extends", "remove"}
+	rank := make(map[string]int)
+	for idx, key := range fieldOrder(t) {
+		rank[key] = len(leading) + idx
+	}
+	for idx, key := range leading {
+		if _, ok := rank[key]; ok {
+			rank[key] = idx
+		}
+	}
+	rankOf := func(key *yaml.Node) int {
+		if key.Tag == "!!merge" {
+			return -1
+		} else if r, ok := rank[key.Value]; ok {
+			return r
+		}
+		return len(rank) + 1
+	}
+
+	pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	// The comment in front of the first key belongs to the whole mapping,
+	// for example a header of the recipe, and stays in front.
+	head := pairs[0][0].HeadComment
+	pairs[0][0].HeadComment = ""
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return rankOf(pairs[i][0]) < rankOf(pairs[j][0])
+	})
+	if head != "" {
+		first := pairs[0][0]
+		if first.HeadComment != "" {
+			head += "\n" + first.HeadComment
+		}
+		first.HeadComment = head
+	}
+
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p[0], p[1])
+	}
+}
+
+// Normalize the node n that is decoded into a value of type t: Mappings are
+// sorted and all collections use block style. Strings are double-quoted,
+// or literal block scalars if they span multiple lines. Strings containing
+// backslashes or double quotes, such as many regular expressions, are
+// single-quoted to avoid escaping.
+func formatNode(n *yaml.Node, t reflect.Type) {
+	if n.Kind == yaml.AliasNode || isNull(n) {
+		// Aliases are formatted where their anchor is defined.
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		n.Style = 0
+		sortKeys(n, t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Tag == "!!merge" {
+				formatNode(value, t)
+				continue
+			}
+			key.Style = 0
+			if f, ok := structField(t, key.Value); ok {
+				formatNode(value, f.Type)
+			}
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		n.Style = 0
+		for _, item := range n.Content {
+			formatNode(item, t.Elem())
+		}
+
+	case reflect.String:
+		if n.Kind != yaml.ScalarNode {
+			return
+		}
+		n.Tag = "!!str"
+		if strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		} else if strings.ContainsAny(n.Value, `\"`) && !strings.Contains(n.Value, "'") && strings.IndexFunc(n.Value, unicode.IsControl) < 0 {
+			n.Style = yaml.SingleQuotedStyle
+		} else {
+			n.Style = yaml.DoubleQuotedStyle
+		}
+
+	default:
+		if n.Kind == yaml.ScalarNode {
+			n.Style = 0
+		}
+	}
+}
+
+// Separate top-level keys with empty lines if they or the previous key span
+// multiple lines. Comments in front of a key belong to it.
+func separateKeys(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	isTopLevel := func(line string) bool {
+		return line != "" && !strings.ContainsAny(line[:1], " \t\n#-")
+	}
+	starts := make([]int, 0)
+	keys := make([]int, 0)
+	for idx, line := range lines {
+		if !isTopLevel(line) {
+			continue
+		}
+		start := idx
+		for start > 0 && strings.HasPrefix(lines[start-1], "#") {
+			start--
+		}
+		starts = append(starts, start)
+		keys = append(keys, idx)
+	}
+
+	var buf bytes.Buffer
+	next := 0
+	for idx, line := range lines {
+		if next < len(starts) && idx == starts[next] {
+			if next > 0 {
+				multiLinePrev := starts[next]-keys[next-1] > 1
+				end := len(lines)
+				if next+1 < len(starts) {
+					end = starts[next+1]
+				}
+				multiLine := end-keys[next] > 1
+				if multiLinePrev || multiLine {
+					buf.WriteString("\n")
+				}
+			}
+			next++
+		}
+		buf.WriteString(line)
+	}
+	return buf.Bytes()
+}
+
+// Format parses the recipe in data and returns it in canonical style, keeping
+// all comments and the version of the format. The recipe must be valid.
+func Format(filename string, data []byte) ([]byte, error) {
+	// Decode a migrated copy to make sure the recipe is valid.
+	v := nodeDecoder{file: filename}
+	if root := v.parse(data); root != nil {
+		v.migrate(root)
+		if len(v.errs) == 0 {
+			v.decodeRecipe(root)
+		}
+	}
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	d := nodeDecoder{file: filename}
+	doc := d.parseDocument(data)
+	if doc == nil {
+		return nil, d.errs
+	}
+	formatNode(doc.Content[0], reflect.TypeOf(recipeFile{}))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+	return separateKeys(buf.Bytes()), nil
+}
+
+// FormatFile rewrites the recipe in filename in canonical style. It returns
+// whether the file was changed.
+func FormatFile(filename string) (bool, error) {
+	if format := FormatOf(filename); format != FormatYAML {
+		return false, fmt.Errorf("Only YAML recipes can be formatted, not %s!", format)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+
+	formatted, err := Format(filename, data)
+	if err != nil || bytes.Equal(data, formatted) {
+		return false, err
+	}
+
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	err = writeFile(filename, formatted, stat)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
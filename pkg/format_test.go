@@ -0,0 +1,173 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	formatted, err := Format("recipe.yml", []byte(`# Harden sshd.
+file: '/etc/ssh/sshd_config'
+version: 1
+tags: [ssh, hardening]
+delete:
+  -
+    search: ^#   # comments
+    id: comments
+replace:
+  - replace: 'Port 22'
+    search: Port .*
+    context: {end: "Match", begin: "^Host"}
+    checkCount: 1
+append: "Line 1\nLine 2\n"
+extends: base.yml
+remove: [unused]
+`))
+	if err != nil {
+		t.Fatalf("could not format recipe: %s\n", err)
+	}
+
+	expected := `# Harden sshd.
+version: 1
+extends: "base.yml"
+
+remove:
+  - "unused"
+
+tags:
+  - "ssh"
+  - "hardening"
+
+file: "/etc/ssh/sshd_config"
+
+delete:
+  - id: "comments"
+    search: "^#" # comments
+
+replace:
+  - context:
+      begin: "^Host"
+      end: "Match"
+    search: "Port .*"
+    replace: "Port 22"
+    checkCount: 1
+
+append: |
+  Line 1
+  Line 2
+`
+	if string(formatted) != expected {
+		t.Errorf("unexpected result:\n%s\nexpected:\n%s", formatted, expected)
+	}
+}
+
+func TestFormat_Invalid(t *testing.T) {
+	_, err := Format("recipe.yml", []byte("file: '/etc/test.conf'\nunknown: 'key'"))
+	if err == nil || err.Error() != "recipe.yml:2:1: Unknown field 'unknown'!" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
+
+// Format recipes and check that they are compiled to the same result.
+func TestFormat_RoundTrip(t *testing.T) {
+	defer useTestMigration()()
+
+	recipes := map[string]string{
+		"base.yml":   baseRecipe,
+		"legacy.yml": legacyRecipe,
+		"host.yml": `
+extends: "base.yml"
+remove: ["unused"]
+name: host
+replace:
+  - id: port
+    replace: "Port 2222"
+  - search: '(\w+) = (\d+)'
+    replace: "$1: $2"
+append: |-
+  trailing
+    indented
+`,
+		"special.yml": `
+file: "/etc/test.conf"
+files: ["/etc/test.d/*.conf"]
+delete:
+  - {search: 'a "quoted" line\t', context: {begin: '^\[section\]$'}}
+  - search: 123
+  - search: "yes"
+append: "  leading spaces\n\ttab\r\n"
+`,
+	}
+	dir := writeRecipes(t, recipes)
+	defer os.RemoveAll(dir)
+
+	formattedDir := writeRecipes(t, map[string]string{})
+	defer os.RemoveAll(formattedDir)
+	for name, recipe := range recipes {
+		formatted, err := Format(name, []byte(recipe))
+		if err != nil {
+			t.Fatalf("could not format %s: %s\n", name, err)
+		}
+		writeRecipeFile(t, path.Join(formattedDir, name), formatted)
+
+		again, err := Format(name, formatted)
+		if err != nil {
+			t.Errorf("could not format %s again: %s\n", name, err)
+		} else if !bytes.Equal(formatted, again) {
+			t.Errorf("formatting %s is not idempotent:\n%s\n%s", name, formatted, again)
+		}
+	}
+
+	for name := range recipes {
+		var r, f Recipe
+		err := r.Read(path.Join(dir, name))
+		if err != nil {
+			t.Fatalf("could not read %s: %s\n", name, err)
+		}
+		err = f.Read(path.Join(formattedDir, name))
+		if err != nil {
+			t.Fatalf("could not read formatted %s: %s\n", name, err)
+		}
+
+		var rBuf, fBuf bytes.Buffer
+		r.Encode(&rBuf)
+		f.Encode(&fBuf)
+		if rBuf.String() != fBuf.String() {
+			t.Errorf("formatted %s differs:\n%s\n%s", name, rBuf.String(), fBuf.String())
+		}
+		for idx := range r.Delete {
+			if r.Delete[idx].SearchRegexp.String() != f.Delete[idx].SearchRegexp.String() {
+				t.Errorf("formatted %s compiles %s differently\n", name, r.Delete[idx].Label())
+			}
+		}
+		for idx := range r.Replace {
+			if !bytes.Equal(r.Replace[idx].ReplaceBytes, f.Replace[idx].ReplaceBytes) {
+				t.Errorf("formatted %s compiles %s differently\n", name, r.Replace[idx].Label())
+			}
+		}
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	filename := writeRecipe(t, "file: '/etc/test.conf'")
+	defer os.Remove(filename)
+
+	changed, err := FormatFile(filename)
+	if err != nil {
+		t.Fatalf("could not format recipe: %s\n", err)
+	} else if !changed {
+		t.Errorf("recipe should be changed\n")
+	}
+	checkContent(t, filename, []byte("file: \"/etc/test.conf\"\n"))
+
+	changed, err = FormatFile(filename)
+	if err != nil {
+		t.Fatalf("could not format recipe: %s\n", err)
+	} else if changed {
+		t.Errorf("recipe should not be changed again\n")
+	}
+}
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// RecipeFormat is the syntax that a recipe is written in. All formats are
+// converted to the same tree of nodes and share validation.
+type RecipeFormat string
+
+const (
+	FormatYAML RecipeFormat = "yaml"
+	FormatJSON RecipeFormat = "json"
+	FormatTOML RecipeFormat = "toml"
+)
+
+var formatExtensions = map[string]RecipeFormat{
+	".yml":  FormatYAML,
+	".yaml": FormatYAML,
+	".json": FormatJSON,
+	".toml": FormatTOML,
+}
+
+// FormatOf detects the format of a recipe from the extension of filename,
+// defaulting to YAML.
+func FormatOf(filename string) RecipeFormat {
+	if format, ok := formatExtensions[filepath.Ext(filename)]; ok {
+		return format
+	}
+	return FormatYAML
+}
+
+// ParseFormat returns the format with name, for example from the command line.
+func ParseFormat(name string) (RecipeFormat, error) {
+	switch format := RecipeFormat(strings.ToLower(name)); format {
+	case FormatYAML, FormatJSON, FormatTOML:
+		return format, nil
+	}
+	return "", fmt.Errorf("Unknown format '%s', expected yaml, json, or toml!", name)
+}
+
+// Return the position of a byte offset in data.
+func offsetPosition(file string, data []byte, offset int) Position {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return Position{file, line, column}
+}
+
+// Parse a JSON document and convert it to nodes. The nodes are built from the
+// tokens of the JSON decoder and not by the YAML parser, which does not accept
+// all escapes of JSON like \/.
+func (d *nodeDecoder) parseJSON(data []byte) *yaml.Node {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		// The offset is after the invalid character.
+		d.errs = append(d.errs, &RecipeError{offsetPosition(d.file, data, int(syntaxErr.Offset)-1), "", syntaxErr.Error()})
+		return nil
+	} else if err != nil {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", err.Error()})
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := d.jsonNode(dec, data)
+	if err != nil {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", err.Error()})
+		return nil
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+}
+
+// Convert the next value from dec to a node. The position of each node is the
+// start of its token in data, after the offset of the previous token and the
+// separators following it.
+func (d *nodeDecoder) jsonNode(dec *json.Decoder, data []byte) (*yaml.Node, error) {
+	offset := int(dec.InputOffset())
+	for offset < len(data) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	pos := offsetPosition(d.file, data, offset)
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &yaml.Node{Kind: yaml.ScalarNode, Line: pos.Line, Column: pos.Column}
+	switch token := token.(type) {
+	case json.Delim:
+		n.Kind, n.Tag = yaml.MappingNode, "!!map"
+		if token == '[' {
+			n.Kind, n.Tag = yaml.SequenceNode, "!!seq"
+		}
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				// The key is a string token.
+				key, err := d.jsonNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, key)
+			}
+			value, err := d.jsonNode(dec, data)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, value)
+		}
+		// Consume the closing delimiter.
+		_, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+	case string:
+		n.Tag, n.Value = "!!str", token
+	case json.Number:
+		n.Tag, n.Value = "!!int", token.String()
+		if strings.ContainsAny(n.Value, ".eE") {
+			n.Tag = "!!float"
+		}
+	case bool:
+		n.Tag, n.Value = "!!bool", strconv.FormatBool(token)
+	case nil:
+		n.Tag, n.Value = "!!null", "null"
+	}
+	return n, nil
+}
+
+// Convert a value decoded from TOML to a node. order contains the index of
+// every key in the document, which determines the order in mappings.
+func tomlNode(v interface{}, key toml.Key, order map[string]int) *yaml.Node {
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// Copy key to not share the array between children.
+		child := func(k string) toml.Key {
+			return append(key[:len(key):len(key)], k)
+		}
+		rank := func(k string) int {
+			if r, ok := order[child(k).String()]; ok {
+				return r
+			}
+			return len(order)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ri, rj := rank(keys[i]), rank(keys[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return keys[i] < keys[j]
+		})
+
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, k := range keys {
+			n.Content = append(n.Content, scalar("!!str", k), tomlNode(v[k], child(k), order))
+		}
+		return n
+	case []map[string]interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, tomlNode(item, key, order))
+		}
+		return n
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, tomlNode(item, key, order))
+		}
+		return n
+	case string:
+		return scalar("!!str", v)
+	case int64:
+		return scalar("!!int", strconv.FormatInt(v, 10))
+	case float64:
+		return scalar("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v))
+	}
+	// Dates and times.
+	return scalar("!!timestamp", fmt.Sprint(v))
+}
+
+// Parse a TOML document and convert it to nodes. TOML does not provide
+// positions of keys, so only errors in the syntax have a line.
+func (d *nodeDecoder) parseTOML(data []byte) *yaml.Node {
+	var v map[string]interface{}
+	md, err := toml.Decode(string(data), &v)
+	if parseErr, ok := err.(toml.ParseError); ok {
+		msg := parseErr.Message
+		if msg == "" {
+			// Strip the line, which is part of the position.
+			msg = parseErr.Error()
+			msg = strings.TrimPrefix(msg, fmt.Sprintf("toml: line %d: ", parseErr.Position.Line))
+			msg = strings.TrimPrefix(msg, fmt.Sprintf("toml: line %d (last key %q): ", parseErr.Position.Line, parseErr.LastKey))
+		}
+		d.errs = append(d.errs, &RecipeError{offsetPosition(d.file, data, parseErr.Position.Start), "", msg})
+		return nil
+	} else if err != nil {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", err.Error()})
+		return nil
+	}
+	if len(v) == 0 {
+		d.errs = append(d.errs, &RecipeError{Position{File: d.file}, "", "Recipe is empty!"})
+		return nil
+	}
+
+	order := make(map[string]int)
+	for idx, key := range md.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = idx
+		}
+	}
+	root := tomlNode(v, nil, order)
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}
+}
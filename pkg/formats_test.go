@@ -0,0 +1,171 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+)
+
+const formatsYAML = `
+name: "formats"
+tags: ["a", "b"]
+file: "/etc/test.conf"
+
+delete:
+  -
+    id: "comments"
+    search: "^#"
+    checkCount: 2
+
+replace:
+  -
+    context:
+      begin: "begin"
+    search: "Port .*"
+    replace: "Port 22"
+
+append: "first\nsecond\n"
+`
+
+const formatsJSON = `{
+	"name": "formats",
+	"tags": ["a", "b"],
+	"file": "/etc/test.conf",
+	"delete": [
+		{"id": "comments", "search": "^#", "checkCount": 2}
+	],
+	"replace": [
+		{"context": {"begin": "begin"}, "search": "Port .*", "replace": "Port 22"}
+	],
+	"append": "first\nsecond\n"
+}`
+
+const formatsTOML = `
+name = "formats"
+tags = ["a", "b"]
+file = "/etc/test.conf"
+append = """
+first
+second
+"""
+
+[[delete]]
+id = "comments"
+search = "^#"
+checkCount = 2
+
+[[replace]]
+context = { begin = "begin" }
+search = "Port .*"
+replace = "Port 22"
+`
+
+func TestRead_Formats(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"formats.yml":  formatsYAML,
+		"formats.json": formatsJSON,
+		"formats.toml": formatsTOML,
+		"formats.txt":  formatsTOML,
+		"host.toml":    "extends = 'formats.json'\nremove = ['comments']",
+	})
+	defer os.RemoveAll(dir)
+
+	var expected Recipe
+	err := expected.Read(path.Join(dir, "formats.yml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+	var expectedBuf bytes.Buffer
+	expected.Encode(&expectedBuf)
+
+	for name, format := range map[string]RecipeFormat{
+		"formats.json": FormatOf("formats.json"),
+		"formats.toml": FormatOf("formats.toml"),
+		"formats.txt":  FormatTOML,
+	} {
+		var r Recipe
+		err := r.ReadFormat(path.Join(dir, name), format)
+		if err != nil {
+			t.Errorf("could not read %s: %s\n", name, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		r.Encode(&buf)
+		if buf.String() != expectedBuf.String() {
+			t.Errorf("%s differs:\n%s\nexpected:\n%s", name, buf.String(), expectedBuf.String())
+		}
+	}
+
+	var host Recipe
+	err = host.Read(path.Join(dir, "host.toml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+	if host.File != "/etc/test.conf" || len(host.Delete) != 0 || len(host.Replace) != 1 {
+		t.Errorf("recipe was not merged correctly: %v\n", host)
+	}
+}
+
+func TestRead_JSONEscapes(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"escapes.json": `{"file": "\/etc\/test.conf", "append": "caf\u00e9\n", "delete": [{"search": "a", "checkCount": 1}]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.Read(path.Join(dir, "escapes.json"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+	if r.File != "/etc/test.conf" || r.Append != "café\n" || len(r.Delete) != 1 || r.Delete[0].CheckCount != 1 {
+		t.Errorf("escapes were not decoded correctly: %v\n", r)
+	}
+}
+
+func TestRead_FormatErrors(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"syntax.json":    "{\n  \"file\": \"/etc/test.conf\",\n}",
+		"comment.json":   "{\n  // comment\n  \"file\": \"/etc/test.conf\"\n}",
+		"unknown.json":   "{\n  \"file\": \"/etc/test.conf\",\n  \"unknown\": \"key\"\n}",
+		"duplicate.json": "{\"file\": \"/etc/a.conf\", \"file\": \"/etc/b.conf\"}",
+		"syntax.toml":    "file = \"/etc/test.conf\"\nsearch =",
+		"unknown.toml":   "file = \"/etc/test.conf\"\n[[delete]]\nsearch = \"a\"\nunknown = \"key\"",
+		"type.toml":      "file = \"/etc/test.conf\"\n[[delete]]\nsearch = \"a\"\ncheckCount = \"one\"",
+		"empty.toml":     "",
+	})
+	defer os.RemoveAll(dir)
+
+	for name, msg := range map[string]string{
+		"syntax.json":    ":3:1: invalid character '}' looking for beginning of object key string",
+		"comment.json":   ":2:3: invalid character '/' looking for beginning of object key string",
+		"unknown.json":   ":3:3: Unknown field 'unknown'!",
+		"duplicate.json": ":1: mapping key \"file\" already defined at line 1",
+		"syntax.toml":    ":2:8: unexpected EOF; expected value",
+		"unknown.toml":   ": delete[0]: Unknown field 'unknown'!",
+		"type.toml":      ": delete[0].checkCount: Expected an integer!",
+		"empty.toml":     ": Recipe is empty!",
+	} {
+		filename := path.Join(dir, name)
+		var r Recipe
+		err := r.Read(filename)
+		if err == nil || err.Error() != filename+msg {
+			t.Errorf("unexpected error for %s: %v\n", name, err)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("TOML")
+	if err != nil || format != FormatTOML {
+		t.Errorf("unexpected result: %v %v\n", format, err)
+	}
+
+	_, err = ParseFormat("xml")
+	if err == nil {
+		t.Errorf("xml should not be a known format\n")
+	}
+}
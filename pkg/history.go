@@ -0,0 +1,269 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Generations is the number of generations that are kept for every
+// configuration file in the state directory. If zero, no history is kept.
+var Generations = 5
+
+// A Generation is a configuration file written by Commit, together with the
+// unmodified input and the recipes that produced it.
+type Generation struct {
+	Number     int       `json:"number"`
+	Time       time.Time `json:"time"`
+	RecipeHash string    `json:"recipeHash,omitempty"`
+	// Number of the generation that was restored by Rollback, zero for
+	// generations written by Commit.
+	Rollback int `json:"rollback,omitempty"`
+
+	dir string
+}
+
+const (
+	generationInfo   = "generation.json"
+	generationInput  = "input"
+	generationOutput = "output"
+)
+
+// Input returns the unmodified input of the generation.
+func (g *Generation) Input() ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(g.dir, generationInput))
+}
+
+// Output returns the configuration file written in the generation.
+func (g *Generation) Output() ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(g.dir, generationOutput))
+}
+
+// HashRecipes returns a hash of the effective recipes, which identifies them
+// in the history.
+func HashRecipes(recipes []Recipe) (string, error) {
+	h := sha256.New()
+	for _, r := range recipes {
+		err := r.Encode(h)
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SetRecipeHash sets the hash of the recipes for the generation recorded on
+// Commit, see HashRecipes.
+func (c *Config) SetRecipeHash(hash string) {
+	c.recipeHash = hash
+}
+
+// History returns the generations of the configuration file filename, the
+// oldest first.
+func History(filename string) ([]Generation, error) {
+	if StateDir == "" {
+		return nil, nil
+	}
+	dir, err := inStateDir("history", filename)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	generations := make([]Generation, 0, len(entries))
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil || !e.IsDir() {
+			continue
+		}
+		g := Generation{dir: filepath.Join(dir, e.Name())}
+		data, err := ioutil.ReadFile(filepath.Join(g.dir, generationInfo))
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &g)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", g.dir, err)
+		}
+		generations = append(generations, g)
+	}
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].Number < generations[j].Number
+	})
+	return generations, nil
+}
+
+// Check if the generation was produced from input and recipeHash and has the
+// output.
+func (g *Generation) matches(input []byte, recipeHash string, output []byte) bool {
+	if g.RecipeHash != recipeHash {
+		return false
+	}
+	data, err := g.Input()
+	if err != nil || !bytes.Equal(data, input) {
+		return false
+	}
+	data, err = g.Output()
+	return err == nil && bytes.Equal(data, output)
+}
+
+// Record a new generation and remove the oldest ones beyond Generations.
+func (c *Config) record(input []byte, output []byte) error {
+	return c.recordGeneration(input, output, c.recipeHash, 0)
+}
+
+// Record a new generation with recipeHash, restored from the generation
+// rollback if not zero.
+func (c *Config) recordGeneration(input []byte, output []byte, recipeHash string, rollback int) error {
+	if StateDir == "" || Generations <= 0 {
+		return nil
+	}
+	generations, err := History(c.base)
+	if err != nil {
+		return err
+	}
+
+	number := 1
+	if len(generations) > 0 {
+		last := generations[len(generations)-1]
+		if last.matches(input, recipeHash, output) {
+			// Applying the same recipes again does not create a generation.
+			return nil
+		}
+		number = last.Number + 1
+	}
+
+	dir, err := inStateDir("history", c.base)
+	if err != nil {
+		return err
+	}
+	g := Generation{
+		Number:     number,
+		Time:       time.Now(),
+		RecipeHash: recipeHash,
+		Rollback:   rollback,
+		dir:        filepath.Join(dir, strconv.Itoa(number)),
+	}
+	err = os.MkdirAll(g.dir, 0700)
+	if err != nil {
+		return err
+	}
+	info, err := json.MarshalIndent(&g, "", "  ")
+	if err != nil {
+		return err
+	}
+	for name, data := range map[string][]byte{
+		generationInput:  input,
+		generationOutput: output,
+		generationInfo:   append(info, '\n'),
+	} {
+		err = ioutil.WriteFile(filepath.Join(g.dir, name), data, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	generations = append(generations, g)
+	for len(generations) > Generations {
+		err = os.RemoveAll(generations[0].dir)
+		if err != nil {
+			return err
+		}
+		generations = generations[1:]
+	}
+	return nil
+}
+
+// Return the index of the generation that the last one is equivalent to,
+// following rollbacks to the generation they restored.
+func currentGeneration(generations []Generation) int {
+	current := len(generations) - 1
+	for current >= 0 && generations[current].Rollback != 0 {
+		restored := -1
+		for idx := 0; idx < current; idx++ {
+			if generations[idx].Number == generations[current].Rollback {
+				restored = idx
+			}
+		}
+		if restored < 0 {
+			// The restored generation was already removed.
+			break
+		}
+		current = restored
+	}
+	return current
+}
+
+// Rollback restores the configuration file and its unmodified copy from the
+// generation with number, and records this as a new generation. If number is
+// zero, the generation before the current one is restored, so repeated calls
+// step back further. It returns the number of the restored generation.
+func (c *Config) Rollback(number int) (int, error) {
+	generations, err := History(c.base)
+	if err != nil {
+		return 0, err
+	}
+
+	var g *Generation
+	if number == 0 {
+		current := currentGeneration(generations)
+		if current < 1 {
+			return 0, fmt.Errorf("There is no previous generation of %s!", c.base)
+		}
+		g = &generations[current-1]
+	} else {
+		for idx := range generations {
+			if generations[idx].Number == number {
+				g = &generations[idx]
+			}
+		}
+		if g == nil {
+			return 0, fmt.Errorf("There is no generation %d of %s!", number, c.base)
+		}
+	}
+
+	input, err := g.Input()
+	if err != nil {
+		return 0, err
+	}
+	output, err := g.Output()
+	if err != nil {
+		return 0, err
+	}
+	attrs, err := c.attrs()
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.writeOrig(input, attrs)
+	if err != nil {
+		return 0, err
+	}
+	err = writeFileAttrs(c.base, output, attrs)
+	if err != nil {
+		return 0, err
+	}
+	err = c.recordOutput(output)
+	if err != nil {
+		return 0, err
+	}
+	err = c.recordGeneration(input, output, g.RecipeHash, g.Number)
+	if err != nil {
+		return 0, err
+	}
+	return g.Number, nil
+}
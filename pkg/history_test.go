@@ -0,0 +1,187 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"testing"
+)
+
+func commitGeneration(t *testing.T, base string, hash string, input []byte, output []byte) {
+	c := newConfig(t, base)
+	c.SetRecipeHash(hash)
+	err := c.Commit(input, output)
+	if err != nil {
+		t.Errorf("could not commit: %s\n", err)
+	}
+}
+
+func checkGenerations(t *testing.T, base string, expected ...int) []Generation {
+	generations, err := History(base)
+	if err != nil {
+		t.Fatalf("could not read history: %s\n", err)
+	}
+	numbers := make([]int, 0, len(generations))
+	for _, g := range generations {
+		numbers = append(numbers, g.Number)
+	}
+	if len(numbers) != len(expected) {
+		t.Fatalf("generations should be %v: %v\n", expected, numbers)
+	}
+	for idx := range numbers {
+		if numbers[idx] != expected[idx] {
+			t.Fatalf("generations should be %v: %v\n", expected, numbers)
+		}
+	}
+	return generations
+}
+
+func TestHistory(t *testing.T) {
+	dir, filenames := createTempFiles(t, "history", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	_, restore := useStateDir(t)
+	defer restore()
+	defer func(generations int) {
+		Generations = generations
+	}(Generations)
+	Generations = 2
+
+	checkGenerations(t, base)
+	commitGeneration(t, base, "a", origData, modifiedData)
+	generations := checkGenerations(t, base, 1)
+	if g := generations[0]; g.RecipeHash != "a" || g.Time.IsZero() {
+		t.Errorf("unexpected generation: %v\n", g)
+	}
+	input, err := generations[0].Input()
+	if err != nil || string(input) != string(origData) {
+		t.Errorf("unexpected input: %s %v\n", input, err)
+	}
+
+	// Applying the same recipes again does not create a generation.
+	commitGeneration(t, base, "a", origData, modifiedData)
+	checkGenerations(t, base, 1)
+
+	commitGeneration(t, base, "b", origData, []byte("second"))
+	commitGeneration(t, base, "b", newData, []byte("third"))
+	generations = checkGenerations(t, base, 2, 3)
+	output, err := generations[1].Output()
+	if err != nil || string(output) != "third" {
+		t.Errorf("unexpected output: %s %v\n", output, err)
+	}
+}
+
+func TestHistory_Disabled(t *testing.T) {
+	dir, filenames := createTempFiles(t, "history_disabled", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	_, restore := useStateDir(t)
+	defer restore()
+	defer func(generations int) {
+		Generations = generations
+	}(Generations)
+	Generations = 0
+
+	commitGeneration(t, base, "a", origData, modifiedData)
+	checkGenerations(t, base)
+}
+
+func TestRollback(t *testing.T) {
+	dir, filenames := createTempFiles(t, "rollback", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	_, restore := useStateDir(t)
+	defer restore()
+
+	_, err := newConfig(t, base).Rollback(0)
+	if err == nil {
+		t.Errorf("rollback without history should fail\n")
+	}
+
+	commitGeneration(t, base, "a", origData, modifiedData)
+	writeTempFile(t, base+".pacnew", newData)
+	commitGeneration(t, base, "a", newData, []byte("updated"))
+	checkContent(t, base, []byte("updated"))
+
+	c := newConfig(t, base)
+	number, err := c.Rollback(0)
+	if err != nil || number != 1 {
+		t.Fatalf("could not roll back: %d %v\n", number, err)
+	}
+	checkContent(t, base, modifiedData)
+	if i := newConfig(t, base).GetInput(); i == base {
+		t.Errorf("there should be an unmodified copy after rollback\n")
+	} else {
+		checkContent(t, i, origData)
+	}
+
+	generations := checkGenerations(t, base, 1, 2, 3)
+	if generations[2].Rollback != 1 {
+		t.Errorf("generation 3 should be a rollback to 1: %d\n", generations[2].Rollback)
+	}
+
+	_, err = c.Rollback(2)
+	if err != nil {
+		t.Fatalf("could not roll back: %s\n", err)
+	}
+	checkContent(t, base, []byte("updated"))
+
+	_, err = c.Rollback(10)
+	if err == nil {
+		t.Errorf("rollback to unknown generation should fail\n")
+	}
+}
+
+func TestRollback_Twice(t *testing.T) {
+	dir, filenames := createTempFiles(t, "rollback", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	_, restore := useStateDir(t)
+	defer restore()
+
+	commitGeneration(t, base, "a", origData, []byte("first"))
+	commitGeneration(t, base, "b", origData, []byte("second"))
+	commitGeneration(t, base, "c", origData, []byte("third"))
+
+	c := newConfig(t, base)
+	number, err := c.Rollback(0)
+	if err != nil || number != 2 {
+		t.Fatalf("could not roll back: %d %v\n", number, err)
+	}
+	checkContent(t, base, []byte("second"))
+
+	number, err = c.Rollback(0)
+	if err != nil || number != 1 {
+		t.Fatalf("could not roll back again: %d %v\n", number, err)
+	}
+	checkContent(t, base, []byte("first"))
+
+	_, err = c.Rollback(0)
+	if err == nil {
+		t.Errorf("rollback before the first generation should fail\n")
+	}
+	checkContent(t, base, []byte("first"))
+}
+
+func TestHashRecipes(t *testing.T) {
+	a := Recipe{File: "/etc/test.conf", Append: "a"}
+	b := Recipe{File: "/etc/test.conf", Append: "b"}
+
+	hashA, err := HashRecipes([]Recipe{a})
+	if err != nil {
+		t.Fatalf("could not hash recipes: %s\n", err)
+	}
+	hashAB, _ := HashRecipes([]Recipe{a, b})
+	hashA2, _ := HashRecipes([]Recipe{a})
+	if hashA == hashAB || hashA != hashA2 {
+		t.Errorf("unexpected hashes: %s %s %s\n", hashA, hashAB, hashA2)
+	}
+}
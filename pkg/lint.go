@@ -0,0 +1,258 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Check if the regular expression contains anchors or word boundaries, in
+// which case a match in a substring does not imply a match in the line.
+func hasAssertions(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return true
+	}
+
+	var walk func(*syntax.Regexp) bool
+	walk = func(r *syntax.Regexp) bool {
+		switch r.Op {
+		case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+			syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+			return true
+		}
+		for _, sub := range r.Sub {
+			if walk(sub) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(parsed)
+}
+
+// Return the literal that every match of re begins with if re is anchored at
+// the start of the line, and whether re consists of only the anchor and the
+// literal.
+func anchoredPrefix(re *regexp.Regexp) (string, bool, bool) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false, false
+	}
+	parsed = parsed.Simplify()
+
+	subs := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		subs = parsed.Sub
+	}
+	if len(subs) == 0 || (subs[0].Op != syntax.OpBeginLine && subs[0].Op != syntax.OpBeginText) {
+		return "", false, false
+	}
+	var prefix strings.Builder
+	idx := 1
+	for ; idx < len(subs); idx++ {
+		if subs[idx].Op != syntax.OpLiteral || subs[idx].Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix.WriteString(string(subs[idx].Rune))
+	}
+	return prefix.String(), idx == len(subs), true
+}
+
+// Check if every line matching search is matched by the delete entry d.
+func deletesAllMatches(d DeleteEntry, search *regexp.Regexp) bool {
+	if d.Search == search.String() || d.SearchRegexp.MatchString("") {
+		return true
+	}
+
+	// If both are anchored at the start of the line, every line matching
+	// search begins with its prefix. A delete pattern of only a literal then
+	// matches as well if the prefix begins with it.
+	deleted, complete, anchored := anchoredPrefix(d.SearchRegexp)
+	if anchored && complete {
+		prefix, _, anchored := anchoredPrefix(search)
+		return anchored && strings.HasPrefix(prefix, deleted)
+	}
+
+	// If search is a plain string, every matching line contains it. The
+	// delete pattern then matches as well if it matches anywhere in the
+	// string and doesn't depend on the surrounding text.
+	literal, complete := search.LiteralPrefix()
+	return complete && !hasAssertions(d.SearchRegexp) && d.SearchRegexp.MatchString(literal)
+}
+
+// Representative lines of configuration files. A pattern that matches all of
+// them probably matches almost every line of a real file.
+var sampleLines = []string{
+	"# comment",
+	"; comment",
+	"[section]",
+	"key = value",
+	"Option yes",
+	"    indented 42",
+	"}",
+	"1",
+}
+
+// Check if re is not anchored and matches every sample line.
+func matchesBroadly(re *regexp.Regexp) bool {
+	if hasAssertions(re) {
+		return false
+	}
+	for _, line := range sampleLines {
+		if !re.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the indices of the capture groups referenced in a replacement
+// template, see regexp.Expand.
+func referencedGroups(re *regexp.Regexp, template string) map[int]bool {
+	names := make(map[string]int)
+	for idx, name := range re.SubexpNames() {
+		if name != "" {
+			names[name] = idx
+		}
+	}
+
+	isNameChar := func(c byte) bool {
+		return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+	}
+
+	groups := make(map[int]bool)
+	for len(template) > 0 {
+		i := strings.Index(template, "$")
+		if i < 0 {
+			break
+		}
+		template = template[i+1:]
+		if len(template) == 0 {
+			break
+		}
+
+		var name string
+		if template[0] == '$' {
+			template = template[1:]
+			continue
+		} else if template[0] == '{' {
+			end := strings.Index(template, "}")
+			if end < 0 {
+				break
+			}
+			name, template = template[1:end], template[end+1:]
+		} else {
+			end := 0
+			for end < len(template) && isNameChar(template[end]) {
+				end++
+			}
+			name, template = template[:end], template[end:]
+		}
+
+		var num int
+		if _, err := fmt.Sscanf(name, "%d", &num); err == nil && fmt.Sprint(num) == name {
+			groups[num] = true
+		} else if idx, ok := names[name]; ok {
+			groups[idx] = true
+		}
+	}
+
+	return groups
+}
+
+// Check if applying the replace entry to its own output changes it again.
+// Without capture groups in the replacement, the output of a line that is
+// replaced completely is the replacement itself. With capture groups, the
+// output depends on the input and cannot be checked.
+func isIdempotent(rs ReplaceEntry) bool {
+	if strings.Contains(rs.Replace, "$") {
+		return true
+	}
+	output := []byte(rs.Replace)
+	again, _ := applyReplacement(rs, output)
+	return bytes.Equal(again, output)
+}
+
+// Lint looks for entries of a compiled recipe that are valid, but probably
+// do not work as intended. It returns a list of warnings.
+func (r *Recipe) Lint() []error {
+	warns := make([]error, 0)
+	warnf := func(pos Position, path string, format string, args ...interface{}) {
+		warns = append(warns, &RecipeError{pos, path, fmt.Sprintf(format, args...)})
+	}
+
+	lintPattern := func(re *regexp.Regexp, pos Position, path string) {
+		if re.MatchString("") {
+			warnf(pos, path, "Pattern matches the empty string and thus every line!")
+		} else if matchesBroadly(re) {
+			warnf(pos, path, "Pattern is not anchored and matches almost every line!")
+		}
+	}
+
+	lintContext := func(c Context, pos positions, label string) {
+		if c.Begin != "" && c.Begin == c.End {
+			warnf(r.entryPosition(pos, "context.end"), joinPath(label, "context"), "Context begins and ends with the same pattern!")
+		}
+		if c.BeginRegexp != nil {
+			lintPattern(c.BeginRegexp, r.entryPosition(pos, "context.begin"), joinPath(label, "context.begin"))
+		}
+		if c.EndRegexp != nil {
+			lintPattern(c.EndRegexp, r.entryPosition(pos, "context.end"), joinPath(label, "context.end"))
+		}
+	}
+
+	for _, d := range r.Delete {
+		lintContext(d.Context, d.pos, d.label)
+		lintPattern(d.SearchRegexp, r.entryPosition(d.pos, "search"), joinPath(d.label, "search"))
+	}
+
+	for _, rs := range r.Replace {
+		lintContext(rs.Context, rs.pos, rs.label)
+		lintPattern(rs.SearchRegexp, r.entryPosition(rs.pos, "search"), joinPath(rs.label, "search"))
+
+		for _, d := range r.Delete {
+			sameContext := d.Context.Begin == rs.Context.Begin && d.Context.End == rs.Context.End
+			if (d.Context.Begin == "" && d.Context.End == "" || sameContext) && deletesAllMatches(d, rs.SearchRegexp) {
+				warnf(r.entryPosition(rs.pos, "search"), joinPath(rs.label, "search"), "All matching lines are deleted by entry '%s'!", d.label)
+				break
+			}
+		}
+
+		if !isIdempotent(rs) {
+			warnf(r.entryPosition(rs.pos, "replace"), joinPath(rs.label, "replace"), "Replacement matches the pattern again, applying the recipe to its own output is not idempotent!")
+		}
+
+		used := referencedGroups(rs.SearchRegexp, rs.Replace)
+		names := rs.SearchRegexp.SubexpNames()
+		for idx := 1; idx <= rs.SearchRegexp.NumSubexp(); idx++ {
+			if used[idx] {
+				continue
+			}
+			group := fmt.Sprint(idx)
+			if names[idx] != "" {
+				group = names[idx]
+			}
+			warnf(r.entryPosition(rs.pos, "search"), joinPath(rs.label, "search"), "Capture group %s is not used in the replacement!", group)
+		}
+	}
+
+	if r.Append != "" {
+		lines := strings.Split(strings.TrimRight(r.Append, "\r\n"), "\n")
+		for idx, line := range lines {
+			line = strings.TrimRight(line, "\r")
+			for _, d := range r.Delete {
+				if d.Context.Begin == "" && d.Context.End == "" && d.SearchRegexp.MatchString(line) {
+					warnf(r.position("append"), "append", "Line %d is deleted by entry '%s' when applying the recipe to its own output!", idx+1, d.label)
+					break
+				}
+			}
+		}
+	}
+
+	return warns
+}
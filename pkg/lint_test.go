@@ -0,0 +1,152 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"testing"
+)
+
+func lint(r Recipe) []string {
+	r.Compile()
+	warns := make([]string, 0)
+	for _, w := range r.Lint() {
+		warns = append(warns, w.Error())
+	}
+	return warns
+}
+
+func checkWarnings(t *testing.T, warns []string, expected []string) {
+	if len(warns) != len(expected) {
+		t.Fatalf("expected warnings %v: %v\n", expected, warns)
+	}
+	for idx, e := range expected {
+		if warns[idx] != e {
+			t.Errorf("warning %d should be '%s': %s\n", idx, e, warns[idx])
+		}
+	}
+}
+
+func TestLint_Clean(t *testing.T) {
+	warns := lint(Recipe{
+		Delete: []DeleteEntry{
+			{Context: Context{Begin: "\\[begin\\]", End: "\\[end\\]"}, Search: "^remove$"},
+		},
+		Replace: []ReplaceEntry{
+			{Search: "key = (.*)", Replace: "key = ${1}0"},
+			{Search: "^#(?P<setting>option)", Replace: "$setting"},
+		},
+		Append: "appended",
+	})
+	checkWarnings(t, warns, []string{})
+}
+
+func TestLint_Context(t *testing.T) {
+	warns := lint(Recipe{
+		Delete: []DeleteEntry{
+			{Context: Context{Begin: "section", End: "section"}, Search: "remove"},
+		},
+		Replace: []ReplaceEntry{
+			{Context: Context{Begin: "x*"}, Search: "search"},
+		},
+	})
+	checkWarnings(t, warns, []string{
+		"delete[0].context: Context begins and ends with the same pattern!",
+		"replace[0].context.begin: Pattern matches the empty string and thus every line!",
+	})
+}
+
+func TestLint_Broad(t *testing.T) {
+	warns := lint(Recipe{
+		Delete: []DeleteEntry{
+			{ID: "all", Search: ".*"},
+		},
+		Replace: []ReplaceEntry{
+			{Search: "^", Replace: "# "},
+			{Search: ".+", Replace: "$0"},
+			{Search: "\\S", Replace: "$0"},
+			{Search: "[^#]", Replace: "$0"},
+			{Search: "^.+", Replace: "$0"},
+		},
+	})
+	checkWarnings(t, warns, []string{
+		"all.search: Pattern matches the empty string and thus every line!",
+		"replace[0].search: Pattern matches the empty string and thus every line!",
+		"replace[0].search: All matching lines are deleted by entry 'all'!",
+		"replace[0].replace: Replacement matches the pattern again, applying the recipe to its own output is not idempotent!",
+		"replace[1].search: Pattern is not anchored and matches almost every line!",
+		"replace[1].search: All matching lines are deleted by entry 'all'!",
+		"replace[2].search: Pattern is not anchored and matches almost every line!",
+		"replace[2].search: All matching lines are deleted by entry 'all'!",
+		"replace[3].search: Pattern is not anchored and matches almost every line!",
+		"replace[3].search: All matching lines are deleted by entry 'all'!",
+		"replace[4].search: All matching lines are deleted by entry 'all'!",
+	})
+}
+
+func TestLint_DeletedReplace(t *testing.T) {
+	warns := lint(Recipe{
+		Delete: []DeleteEntry{
+			{Search: "^Port"},
+			{Search: "Listen"},
+			{Context: Context{Begin: "section"}, Search: "User"},
+			{Search: "^#"},
+		},
+		Replace: []ReplaceEntry{
+			{Search: "Port 22", Replace: "Port 8022"},
+			{Search: "^Port", Replace: "# Port"},
+			{Search: "ListenAddress", Replace: "Address"},
+			{Search: "User root", Replace: "User nobody"},
+			{Context: Context{Begin: "section"}, Search: "User", Replace: "Group"},
+			{Search: "^# comment", Replace: "comment"},
+			{Search: "^#(.*)", Replace: "$1"},
+			{Search: "^ # comment", Replace: "comment"},
+		},
+	})
+	checkWarnings(t, warns, []string{
+		"replace[1].search: All matching lines are deleted by entry 'delete[0]'!",
+		"replace[2].search: All matching lines are deleted by entry 'delete[1]'!",
+		"replace[4].search: All matching lines are deleted by entry 'delete[2]'!",
+		"replace[5].search: All matching lines are deleted by entry 'delete[3]'!",
+		"replace[6].search: All matching lines are deleted by entry 'delete[3]'!",
+	})
+}
+
+func TestLint_Idempotent(t *testing.T) {
+	warns := lint(Recipe{
+		Replace: []ReplaceEntry{
+			{Search: "enabled", Replace: "enabled=yes"},
+			{Search: "^enabled$", Replace: "enabled=yes"},
+			{Search: "^Port .*", Replace: "Port 22"},
+			{Search: "#?Port", Replace: "Port"},
+			{Search: "a+", Replace: "aa"},
+		},
+	})
+	checkWarnings(t, warns, []string{
+		"replace[0].replace: Replacement matches the pattern again, applying the recipe to its own output is not idempotent!",
+	})
+}
+
+func TestLint_Append(t *testing.T) {
+	warns := lint(Recipe{
+		Delete: []DeleteEntry{
+			{Search: "^Port"},
+			{Context: Context{End: "end"}, Search: "Listen"},
+		},
+		Append: "# Added\nPort 2222\nListen 0.0.0.0\n",
+	})
+	checkWarnings(t, warns, []string{
+		"append: Line 2 is deleted by entry 'delete[0]' when applying the recipe to its own output!",
+	})
+}
+
+func TestLint_CaptureGroups(t *testing.T) {
+	warns := lint(Recipe{
+		Replace: []ReplaceEntry{
+			{Search: "(a)(b)(?P<name>c)(d)", Replace: "$1${name}$$4 $2x"},
+		},
+	})
+	checkWarnings(t, warns, []string{
+		"replace[0].search: Capture group 2 is not used in the replacement!",
+		"replace[0].search: Capture group 4 is not used in the replacement!",
+	})
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RecipeDirs lists the directories that are searched for recipes, in order of
+// decreasing precedence: A recipe in an earlier directory replaces all recipes
+// with the same filename in later directories.
+var RecipeDirs = []string{
+	"/etc/dynconf.d",     // local administrator
+	"/run/dynconf.d",     // runtime
+	"/usr/share/dynconf", // installed by packages
+}
+
+func isRecipeFile(filename string) bool {
+	_, ok := formatExtensions[filepath.Ext(filename)]
+	return ok
+}
+
+// A recipe is masked if it is a symlink to /dev/null.
+func isMasked(filename string) bool {
+	target, err := os.Readlink(filename)
+	return err == nil && target == os.DevNull
+}
+
+// FindRecipes returns the recipe files in dirs, sorted by filename. For every
+// filename only the file in the first directory is used, and it is skipped
+// entirely if that file is masked by a symlink to /dev/null. Directories that
+// do not exist are ignored.
+func FindRecipes(dirs []string) ([]string, error) {
+	found := make(map[string]string)
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || !isRecipeFile(name) {
+				continue
+			}
+			if _, ok := found[name]; ok {
+				// Overridden by a directory with higher precedence.
+				continue
+			}
+
+			filename := filepath.Join(dir, name)
+			if isMasked(filename) {
+				found[name] = ""
+			} else {
+				found[name] = filename
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name, filename := range found {
+		if filename != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, found[name])
+	}
+	return files, nil
+}
+
+// Filter selects recipes by their names and tags. A recipe is selected if it
+// has one of the names or is tagged with one of the tags. The empty filter
+// selects all recipes.
+type Filter struct {
+	Names []string
+	Tags  []string
+}
+
+func (f Filter) IsEmpty() bool {
+	return len(f.Names) == 0 && len(f.Tags) == 0
+}
+
+func (f Filter) Match(r *Recipe) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	for _, name := range f.Names {
+		if r.Name == name {
+			return true
+		}
+	}
+	for _, tag := range f.Tags {
+		if r.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRecipes reads and validates all recipes found in dirs and returns those
+// selected by filter. If a recipe is invalid, the error is of type Errors and
+// lists all problems.
+func LoadRecipes(dirs []string, filter Filter) ([]Recipe, error) {
+	files, err := FindRecipes(dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := make([]Recipe, 0, len(files))
+	for _, file := range files {
+		var r Recipe
+		err = r.Read(file)
+		if err != nil {
+			return nil, err
+		}
+
+		errs, _ := r.Validate()
+		if len(errs) > 0 {
+			return nil, Errors(errs)
+		}
+
+		if filter.Match(&r) {
+			recipes = append(recipes, r)
+		}
+	}
+
+	return recipes, nil
+}
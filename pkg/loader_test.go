@@ -0,0 +1,125 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func createRecipeDirs(t *testing.T) (string, []string) {
+	root, err := ioutil.TempDir("", "recipedirs")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s\n", err)
+	}
+
+	dirs := []string{path.Join(root, "etc"), path.Join(root, "run"), path.Join(root, "usr")}
+	for _, dir := range dirs {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			os.RemoveAll(root)
+			t.Fatalf("could not create %s: %s\n", dir, err)
+		}
+	}
+
+	return root, dirs
+}
+
+func writeRecipeFile(t *testing.T, filename string, data []byte) {
+	err := ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		t.Fatalf("could not write to %s: %s\n", filename, err)
+	}
+}
+
+func TestFindRecipes(t *testing.T) {
+	root, dirs := createRecipeDirs(t)
+	defer os.RemoveAll(root)
+
+	writeRecipeFile(t, path.Join(dirs[2], "a.yml"), []byte("file: /a"))
+	writeRecipeFile(t, path.Join(dirs[2], "b.yml"), []byte("file: /b"))
+	writeRecipeFile(t, path.Join(dirs[2], "c.yml"), []byte("file: /c"))
+	writeRecipeFile(t, path.Join(dirs[2], "README"), []byte("not a recipe"))
+	writeRecipeFile(t, path.Join(dirs[1], "b.yml"), []byte("file: /b-run"))
+	writeRecipeFile(t, path.Join(dirs[0], "b.yml"), []byte("file: /b-etc"))
+	writeRecipeFile(t, path.Join(dirs[1], "d.yaml"), []byte("file: /d"))
+	err := os.Symlink(os.DevNull, path.Join(dirs[0], "c.yml"))
+	if err != nil {
+		t.Fatalf("could not create symlink: %s\n", err)
+	}
+
+	files, err := FindRecipes(append(dirs, path.Join(root, "missing")))
+	if err != nil {
+		t.Fatalf("could not find recipes: %s\n", err)
+	}
+
+	expected := []string{path.Join(dirs[2], "a.yml"), path.Join(dirs[0], "b.yml"), path.Join(dirs[1], "d.yaml")}
+	if len(files) != len(expected) {
+		t.Fatalf("expected recipes %v: %v\n", expected, files)
+	}
+	for idx, e := range expected {
+		if files[idx] != e {
+			t.Errorf("recipe %d should be %s: %s\n", idx, e, files[idx])
+		}
+	}
+}
+
+func TestLoadRecipes(t *testing.T) {
+	root, dirs := createRecipeDirs(t)
+	defer os.RemoveAll(root)
+
+	writeRecipeFile(t, path.Join(dirs[2], "a.yml"), []byte("file: /a"))
+	writeRecipeFile(t, path.Join(dirs[0], "a.yml"), []byte("file: /a-etc"))
+
+	recipes, err := LoadRecipes(dirs, Filter{})
+	if err != nil {
+		t.Fatalf("could not load recipes: %s\n", err)
+	}
+	if len(recipes) != 1 || recipes[0].File != "/a-etc" {
+		t.Errorf("recipe in etc should override: %v\n", recipes)
+	}
+}
+
+func TestLoadRecipes_Invalid(t *testing.T) {
+	root, dirs := createRecipeDirs(t)
+	defer os.RemoveAll(root)
+
+	writeRecipeFile(t, path.Join(dirs[0], "a.yml"), []byte("file: ''"))
+
+	_, err := LoadRecipes(dirs, Filter{})
+	if err == nil || err.Error() != path.Join(dirs[0], "a.yml")+":1:7: file: Cannot have empty filename!" {
+		t.Errorf("invalid recipe should not be loaded: %v\n", err)
+	}
+}
+
+func TestLoadRecipes_Filter(t *testing.T) {
+	root, dirs := createRecipeDirs(t)
+	defer os.RemoveAll(root)
+
+	writeRecipeFile(t, path.Join(dirs[0], "10-sshd.yml"), []byte(`
+name: sshd
+tags: [ssh]
+file: /etc/ssh/sshd_config`))
+	writeRecipeFile(t, path.Join(dirs[0], "20-ssh.yml"), []byte(`
+tags: [ssh, client]
+file: /etc/ssh/ssh_config`))
+	writeRecipeFile(t, path.Join(dirs[0], "30-sysctl.yml"), []byte(`
+tags: [hardening]
+file: /etc/sysctl.conf`))
+	writeRecipeFile(t, path.Join(dirs[0], "40-other.yml"), []byte(`
+file: /etc/other.conf`))
+
+	recipes, err := LoadRecipes(dirs, Filter{Tags: []string{"client", "hardening"}})
+	if err != nil {
+		t.Fatalf("could not load recipes: %s\n", err)
+	}
+	checkNames(t, recipes, []string{"20-ssh", "30-sysctl"})
+
+	recipes, err = LoadRecipes(dirs, Filter{Names: []string{"sshd", "40-other"}})
+	if err != nil {
+		t.Fatalf("could not load recipes: %s\n", err)
+	}
+	checkNames(t, recipes, []string{"sshd", "40-other"})
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+)
+
+// Return for every line of a the index of the equal line in b, or -1.
+func matchLines(a []string, b []string) []int {
+	matches := make([]int, len(a))
+	for idx := range matches {
+		matches[idx] = -1
+	}
+	for _, e := range diffLines(a, b) {
+		if e.op == diffEqual {
+			matches[e.a] = e.b
+		}
+	}
+	return matches
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// Write lines, terminating the last one if needed for a conflict marker.
+func writeLines(buf *bytes.Buffer, lines []string, terminate bool) {
+	for _, l := range lines {
+		buf.WriteString(l)
+	}
+	if terminate && len(lines) > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+}
+
+// Merge performs a line-based three-way merge of the changes from base to
+// ours and from base to theirs. It returns the result, which is not nil even if
+// empty, and whether it is clean.
+// If both change the same lines differently, the result contains both versions
+// between conflict markers labeled with oursName and theirsName.
+func Merge(base []byte, ours []byte, oursName string, theirs []byte, theirsName string) ([]byte, bool) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchOurs, matchTheirs := matchLines(b, o), matchLines(b, t)
+
+	var buf bytes.Buffer
+	clean := true
+	bi, oi, ti := 0, 0, 0
+	for {
+		// Find the next line of base that is unchanged on both sides.
+		next := bi
+		for next < len(b) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		nextOurs, nextTheirs := len(o), len(t)
+		if next < len(b) {
+			nextOurs, nextTheirs = matchOurs[next], matchTheirs[next]
+		}
+
+		chunkBase, chunkOurs, chunkTheirs := b[bi:next], o[oi:nextOurs], t[ti:nextTheirs]
+		switch {
+		case equalLines(chunkOurs, chunkBase):
+			writeLines(&buf, chunkTheirs, false)
+		case equalLines(chunkTheirs, chunkBase), equalLines(chunkOurs, chunkTheirs):
+			writeLines(&buf, chunkOurs, false)
+		default:
+			clean = false
+			buf.WriteString("<<<<<<< " + oursName + "\n")
+			writeLines(&buf, chunkOurs, true)
+			buf.WriteString("=======\n")
+			writeLines(&buf, chunkTheirs, true)
+			buf.WriteString(">>>>>>> " + theirsName + "\n")
+		}
+
+		if next == len(b) {
+			break
+		}
+		buf.WriteString(b[next])
+		bi, oi, ti = next+1, nextOurs+1, nextTheirs+1
+	}
+	if buf.Len() == 0 {
+		// Not nil, so callers can tell an empty result apart from no merge.
+		return []byte{}, clean
+	}
+	return buf.Bytes(), clean
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for _, test := range []struct {
+		base, ours, theirs string
+		expected           string
+		clean              bool
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", true},
+		{"a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", true},
+		{"a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", true},
+		{"a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", "a\nB\nc\n", true},
+		{"a\nb\nc\n", "a\nc\n", "a\nb\nc\nd\n", "a\nc\nd\n", true},
+		{"a\nb\nc\n", "x\na\nb\nc\n", "a\nb\nc\ny\n", "x\na\nb\nc\ny\n", true},
+		{
+			"a\nb\nc\n", "a\nours\nc\n", "a\ntheirs\nc\n",
+			"a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n", false,
+		},
+		{
+			"a\n", "a\nours", "a\ntheirs\n",
+			"a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n", false,
+		},
+		{"a\n", "", "a\n", "", true},
+	} {
+		merged, clean := Merge([]byte(test.base), []byte(test.ours), "ours", []byte(test.theirs), "theirs")
+		if merged == nil || string(merged) != test.expected || clean != test.clean {
+			t.Errorf("unexpected merge of '%s', '%s', and '%s' (clean: %v):\n%s", test.base, test.ours, test.theirs, clean, merged)
+		}
+	}
+}
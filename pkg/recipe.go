@@ -4,86 +4,270 @@ package dynconf
 
 import (
 	"fmt"
-	"os"
-	"path"
+	"io"
+	"io/ioutil"
+	"path/filepath"
 	"regexp"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type Context struct {
-	Begin       string
-	BeginRegexp *regexp.Regexp
-	End         string
-	EndRegexp   *regexp.Regexp
+	Begin       string         `yaml:"begin,omitempty"`
+	BeginRegexp *regexp.Regexp `yaml:"-"`
+	End         string         `yaml:"end,omitempty"`
+	EndRegexp   *regexp.Regexp `yaml:"-"`
 }
 
 type DeleteEntry struct {
-	Context      Context
-	Search       string
-	SearchRegexp *regexp.Regexp
-	CheckCount   int `yaml:"checkCount"`
+	ID           string         `yaml:"id,omitempty"`
+	Context      Context        `yaml:"context,omitempty"`
+	Search       string         `yaml:"search"`
+	SearchRegexp *regexp.Regexp `yaml:"-"`
+	CheckCount   int            `yaml:"checkCount,omitempty"`
+
+	label string
+	pos   positions
+}
+
+// Label identifies the entry in diagnostics. This is the ID if set, or the
+// position in the recipe like "delete[3]" otherwise.
+func (d *DeleteEntry) Label() string {
+	return d.label
+}
+
+func (d *DeleteEntry) fieldPositions() *positions {
+	return &d.pos
 }
 
 type ReplaceEntry struct {
-	Context      Context
-	Search       string
-	SearchRegexp *regexp.Regexp
-	Replace      string
-	ReplaceBytes []byte
-	CheckCount   int `yaml:"checkCount"`
+	ID           string         `yaml:"id,omitempty"`
+	Context      Context        `yaml:"context,omitempty"`
+	Search       string         `yaml:"search"`
+	SearchRegexp *regexp.Regexp `yaml:"-"`
+	Replace      string         `yaml:"replace"`
+	ReplaceBytes []byte         `yaml:"-"`
+	CheckCount   int            `yaml:"checkCount,omitempty"`
+
+	label string
+	pos   positions
+}
+
+// Label identifies the entry in diagnostics. This is the ID if set, or the
+// position in the recipe like "replace[3]" otherwise.
+func (r *ReplaceEntry) Label() string {
+	return r.label
+}
+
+func (r *ReplaceEntry) fieldPositions() *positions {
+	return &r.pos
+}
+
+var idRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func entryLabel(kind string, idx int, id string) string {
+	if id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s[%d]", kind, idx)
 }
 
 type Recipe struct {
-	File    string
-	Delete  []DeleteEntry
-	Replace []ReplaceEntry
-	Append  string
+	// Version of the recipe format, see CurrentVersion. Read migrates
+	// recipes in older versions and sets it to CurrentVersion.
+	Version int `yaml:"version,omitempty"`
+
+	Name        string   `yaml:"name,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Tags        []string `yaml:"tags,omitempty"`
+	After       []string `yaml:"after,omitempty"`
+
+	File    string         `yaml:"file,omitempty"`
+	Files   []string       `yaml:"files,omitempty"`
+	Delete  []DeleteEntry  `yaml:"delete,omitempty"`
+	Replace []ReplaceEntry `yaml:"replace,omitempty"`
+	Append  string         `yaml:"append,omitempty"`
 
+	// Create the file if it does not exist, with Template as the input.
+	Create   bool   `yaml:"create,omitempty"`
+	Template string `yaml:"template,omitempty"`
+	// Mode, Owner, and Group to write the file with, see FileAttributes.
+	Mode  string `yaml:"mode,omitempty"`
+	Owner string `yaml:"owner,omitempty"`
+	Group string `yaml:"group,omitempty"`
+
+	filename   string
+	pos        positions
 	hasContext bool
 	hasCount   bool
 }
 
+// Read decodes and compiles the recipe in filename, detecting the format from
+// its extension.
 func (r *Recipe) Read(filename string) error {
-	file, err := os.Open(filename)
+	return r.ReadFormat(filename, FormatOf(filename))
+}
+
+// ReadFormat decodes and compiles the recipe in filename, which is written in
+// format. Recipes that it extends are read in the format of their extension.
+// If patterns do not compile, the error also lists the problems found by
+// Validate.
+func (r *Recipe) ReadFormat(filename string, format RecipeFormat) error {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	dec := yaml.NewDecoder(file)
-	dec.SetStrict(true)
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	*r, err = decodeExtended(filename, filepath.Dir(filename), format, data, map[string]bool{abs: true})
+	if err != nil {
+		return err
+	}
+	r.filename = filename
+	if r.Name == "" {
+		r.Name = r.baseName()
+	}
+
+	return r.compileDecoded()
+}
+
+// InputName is used in diagnostics for recipes that are decoded from a
+// reader instead of read from a file.
+const InputName = "<input>"
+
+// Decode reads a recipe in YAML from reader and compiles it. Relative paths in
+// 'extends' are resolved against the current directory.
+func (r *Recipe) Decode(reader io.Reader) error {
+	return r.DecodeFormat(reader, FormatYAML, "")
+}
 
-	err = dec.Decode(r)
+// DecodeFormat reads a recipe in format from reader and compiles it. Relative
+// paths in 'file', 'files', and 'extends' are resolved against baseDir. If
+// baseDir is empty, they are relative to the current directory. If the recipe
+// has no name, it is named InputName. Errors are reported like by ReadFormat.
+func (r *Recipe) DecodeFormat(reader io.Reader, format RecipeFormat, baseDir string) error {
+	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return err
 	}
 
-	return r.Compile()
+	dir := baseDir
+	if dir == "" {
+		dir = "."
+	}
+	*r, err = decodeExtended(InputName, dir, format, data, make(map[string]bool))
+	if err != nil {
+		return err
+	}
+	if r.Name == "" {
+		r.Name = InputName
+	}
+
+	if baseDir != "" {
+		resolve := func(p string) string {
+			if p == "" || filepath.IsAbs(p) {
+				return p
+			}
+			return filepath.Join(baseDir, p)
+		}
+		r.File = resolve(r.File)
+		for idx, f := range r.Files {
+			r.Files[idx] = resolve(f)
+		}
+	}
+
+	return r.compileDecoded()
 }
 
-func (r *Recipe) Compile() error {
-	var err error
+// Compile a decoded recipe. If patterns do not compile, the errors from
+// Validate are added to report all problems at once.
+func (r *Recipe) compileDecoded() error {
+	err := r.Compile()
+	if errs, ok := err.(Errors); ok {
+		invalid, _ := r.Validate()
+		return append(errs, invalid...)
+	}
+	return err
+}
 
-	for idx, d := range r.Delete {
-		r.Delete[idx].SearchRegexp, err = regexp.Compile(d.Search)
+// Return the filename of the recipe without directory and extension.
+func (r *Recipe) baseName() string {
+	if r.filename == "" {
+		return ""
+	}
+	base := filepath.Base(r.filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Encode writes the recipe in YAML. For recipes extending other recipes, this
+// is the effective recipe after resolving all inherited entries.
+func (r *Recipe) Encode(w io.Writer) error {
+	c := *r
+	c.Version = CurrentVersion
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(&c)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// HasTag checks if the recipe is tagged with tag.
+func (r *Recipe) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the position of a field of the recipe, falling back to the file.
+func (r *Recipe) position(field string) Position {
+	if pos, ok := r.pos[field]; ok {
+		return pos
+	}
+	return Position{File: r.filename}
+}
+
+// Return the position of a field in an entry, falling back to the file.
+func (r *Recipe) entryPosition(pos positions, field string) Position {
+	if p := pos.get(field); p.File != "" {
+		return p
+	}
+	return Position{File: r.filename}
+}
+
+// Compile all regular expressions of the recipe. If there are errors, they
+// are returned as Errors.
+func (r *Recipe) Compile() error {
+	errs := make(Errors, 0)
+	compile := func(pattern string, pos positions, path string, field string) *regexp.Regexp {
+		re, err := regexp.Compile(pattern)
 		if err != nil {
-			return err
+			errs = append(errs, &RecipeError{r.entryPosition(pos, field), joinPath(path, field), err.Error()})
 		}
+		return re
+	}
+
+	for idx, d := range r.Delete {
+		label := entryLabel("delete", idx, d.ID)
+		r.Delete[idx].label = label
+		r.Delete[idx].SearchRegexp = compile(d.Search, d.pos, label, "search")
 
 		if d.Context.Begin != "" {
 			r.hasContext = true
-			r.Delete[idx].Context.BeginRegexp, err = regexp.Compile(d.Context.Begin)
-			if err != nil {
-				return err
-			}
+			r.Delete[idx].Context.BeginRegexp = compile(d.Context.Begin, d.pos, label, "context.begin")
 		}
 		if d.Context.End != "" {
 			r.hasContext = true
-			r.Delete[idx].Context.EndRegexp, err = regexp.Compile(d.Context.End)
-			if err != nil {
-				return err
-			}
+			r.Delete[idx].Context.EndRegexp = compile(d.Context.End, d.pos, label, "context.end")
 		}
 
 		if d.CheckCount > 0 {
@@ -92,25 +276,18 @@ func (r *Recipe) Compile() error {
 	}
 
 	for idx, sr := range r.Replace {
-		r.Replace[idx].SearchRegexp, err = regexp.Compile(sr.Search)
-		if err != nil {
-			return err
-		}
+		label := entryLabel("replace", idx, sr.ID)
+		r.Replace[idx].label = label
+		r.Replace[idx].SearchRegexp = compile(sr.Search, sr.pos, label, "search")
 		r.Replace[idx].ReplaceBytes = []byte(sr.Replace)
 
 		if sr.Context.Begin != "" {
 			r.hasContext = true
-			r.Replace[idx].Context.BeginRegexp, err = regexp.Compile(sr.Context.Begin)
-			if err != nil {
-				return err
-			}
+			r.Replace[idx].Context.BeginRegexp = compile(sr.Context.Begin, sr.pos, label, "context.begin")
 		}
 		if sr.Context.End != "" {
 			r.hasContext = true
-			r.Replace[idx].Context.EndRegexp, err = regexp.Compile(sr.Context.End)
-			if err != nil {
-				return err
-			}
+			r.Replace[idx].Context.EndRegexp = compile(sr.Context.End, sr.pos, label, "context.end")
 		}
 
 		if sr.CheckCount > 0 {
@@ -118,34 +295,159 @@ func (r *Recipe) Compile() error {
 		}
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
+// Return all filename patterns of this recipe, starting with File.
+func (r *Recipe) patterns() []string {
+	patterns := make([]string, 0, len(r.Files)+1)
+	if len(r.File) > 0 {
+		patterns = append(patterns, r.File)
+	}
+	return append(patterns, r.Files...)
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Targets expands File and Files into the list of configuration files that
+// the recipe should be applied to. Patterns without meta characters are
+// returned unchanged, globs are expanded with filepath.Glob and must match
+// at least one file.
+func (r *Recipe) Targets() ([]string, error) {
+	return r.targets(true)
+}
+
+// Expand File and Files, see Targets. Unless strict, globs that do not match
+// any file are skipped.
+func (r *Recipe) targets(strict bool) ([]string, error) {
+	targets := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, pattern := range r.patterns() {
+		matches := []string{pattern}
+		if isGlob(pattern) {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pattern '%s': %s", pattern, err)
+			}
+
+			// Skip directories and files created by DynConf or a package manager.
+			filtered := make([]string, 0, len(matches))
+			for _, m := range matches {
+				if !isAuxiliary(m) && !isDir(m) {
+					filtered = append(filtered, m)
+				}
+			}
+			matches = filtered
+
+			if len(matches) == 0 && strict {
+				return nil, fmt.Errorf("Pattern '%s' did not match any file!", pattern)
+			}
+		}
+
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				targets = append(targets, m)
+			}
+		}
+	}
+
+	return targets, nil
+}
+
 func (r *Recipe) Validate() ([]error, []error) {
 	errs := make([]error, 0)
 	warns := make([]error, 0)
+	errorf := func(path string, pos Position, format string, args ...interface{}) {
+		errs = append(errs, &RecipeError{pos, path, fmt.Sprintf(format, args...)})
+	}
+
+	if len(r.File) == 0 && len(r.Files) == 0 {
+		errorf("file", r.position("file"), "Cannot have empty filename!")
+	}
+	checkPattern := func(path string, p string) {
+		if len(p) == 0 {
+			return
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			errorf(path, r.position(path), "Invalid pattern '%s': %s", p, err)
+		} else if !filepath.IsAbs(p) {
+			warns = append(warns, &RecipeError{r.position(path), path, "File should reference an absolute path!"})
+		}
+	}
+	checkPattern("file", r.File)
+	for idx, f := range r.Files {
+		path := fmt.Sprintf("files[%d]", idx)
+		if len(f) == 0 {
+			errorf(path, r.position(path), "Cannot have empty filename!")
+		}
+		checkPattern(path, f)
+	}
 
-	if len(r.File) == 0 {
-		errs = append(errs, fmt.Errorf("Cannot have empty filename!"))
-	} else if !path.IsAbs(r.File) {
-		warns = append(warns, fmt.Errorf("File should reference an absolute path!"))
+	if r.Create {
+		if isGlob(r.File) {
+			errorf("file", r.position("file"), "Cannot create files matching a glob!")
+		}
+		for idx, f := range r.Files {
+			if isGlob(f) {
+				path := fmt.Sprintf("files[%d]", idx)
+				errorf(path, r.position(path), "Cannot create files matching a glob!")
+			}
+		}
+	} else if len(r.Template) > 0 {
+		errorf("template", r.position("template"), "Cannot have a template without 'create'!")
+	}
+	if len(r.Mode) > 0 && !modeRegexp.MatchString(r.Mode) {
+		errorf("mode", r.position("mode"), "Invalid mode '%s', expected an octal number like '0644'!", r.Mode)
 	}
 
-	for _, d := range r.Delete {
+	for idx, t := range r.Tags {
+		if len(t) == 0 {
+			path := fmt.Sprintf("tags[%d]", idx)
+			errorf(path, r.position(path), "Cannot have empty tag!")
+		}
+	}
+
+	ids := make(map[string]bool)
+	checkID := func(id string, label string, pos positions) {
+		if len(id) == 0 {
+			return
+		}
+		path := joinPath(label, "id")
+		if !idRegexp.MatchString(id) {
+			errorf(path, r.entryPosition(pos, "id"), "Id '%s' may only contain letters, digits, '_', '.', and '-'!", id)
+		} else if ids[id] {
+			errorf(path, r.entryPosition(pos, "id"), "Duplicate id '%s'!", id)
+		}
+		ids[id] = true
+	}
+
+	for idx, d := range r.Delete {
+		label := entryLabel("delete", idx, d.ID)
+		checkID(d.ID, fmt.Sprintf("delete[%d]", idx), d.pos)
 		if len(d.Search) == 0 {
-			errs = append(errs, fmt.Errorf("Delete entry cannot have empty regex!"))
+			errorf(joinPath(label, "search"), r.entryPosition(d.pos, "search"), "Cannot have empty regex!")
 		}
 		if d.CheckCount < 0 {
-			errs = append(errs, fmt.Errorf("Delete entry cannot have negative count!"))
+			errorf(joinPath(label, "checkCount"), r.entryPosition(d.pos, "checkCount"), "Cannot have negative count!")
 		}
 	}
 
-	for _, rs := range r.Replace {
+	for idx, rs := range r.Replace {
+		label := entryLabel("replace", idx, rs.ID)
+		checkID(rs.ID, fmt.Sprintf("replace[%d]", idx), rs.pos)
 		if len(rs.Search) == 0 {
-			errs = append(errs, fmt.Errorf("Replace entry cannot have empty regex!"))
+			errorf(joinPath(label, "search"), r.entryPosition(rs.pos, "search"), "Cannot have empty regex!")
 		}
 		if rs.CheckCount < 0 {
-			errs = append(errs, fmt.Errorf("Replace entry cannot have negative count!"))
+			errorf(joinPath(label, "checkCount"), r.entryPosition(rs.pos, "checkCount"), "Cannot have negative count!")
 		}
 	}
 
@@ -5,6 +5,8 @@ package dynconf
 import (
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 )
 
@@ -261,3 +263,352 @@ func TestValidateWarns(t *testing.T) {
 		t.Errorf("unexpected number of warnings: %d\n", len(warns))
 	}
 }
+
+func TestRead_Files(t *testing.T) {
+	filename := writeRecipe(t, `
+file: "/etc/test.conf"
+files:
+  - "/etc/test.d/*.conf"
+  - "/etc/other.conf"`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	if err != nil {
+		t.Errorf("could not read recipe: %s\n", err)
+	}
+
+	if r.File != "/etc/test.conf" {
+		t.Errorf("file was not read correctly: %s\n", r.File)
+	}
+	if len(r.Files) != 2 || r.Files[0] != "/etc/test.d/*.conf" || r.Files[1] != "/etc/other.conf" {
+		t.Errorf("files were not read correctly: %v\n", r.Files)
+	}
+
+	errs, warns := r.Validate()
+	if len(errs) != 0 {
+		t.Errorf("unexpected number of errors: %d\n", len(errs))
+	} else if len(warns) != 0 {
+		t.Errorf("unexpected number of warnings: %d\n", len(warns))
+	}
+}
+
+func TestValidateErrs_Files(t *testing.T) {
+	r := Recipe{Files: []string{"", "/etc/[test.conf"}}
+	errs, warns := r.Validate()
+	if len(errs) != 2 {
+		t.Errorf("unexpected number of errors: %d\n", len(errs))
+	} else if len(warns) != 0 {
+		t.Errorf("unexpected number of warnings: %d\n", len(warns))
+	}
+}
+
+func TestTargets(t *testing.T) {
+	dir, filenames := createTempFiles(t, "targets", []string{
+		"a.network",
+		"b.network",
+		"b.network.orig",
+		"c.network.pacnew",
+		"other.conf",
+	})
+	defer os.RemoveAll(dir)
+
+	r := Recipe{
+		File:  path.Join(dir, "*.network"),
+		Files: []string{filenames[4], filenames[0], path.Join(dir, "missing.conf")},
+	}
+	targets, err := r.Targets()
+	if err != nil {
+		t.Fatalf("could not expand targets: %s\n", err)
+	}
+
+	expected := []string{filenames[0], filenames[1], filenames[4], path.Join(dir, "missing.conf")}
+	if len(targets) != len(expected) {
+		t.Fatalf("unexpected targets: %v\n", targets)
+	}
+	for idx, e := range expected {
+		if targets[idx] != e {
+			t.Errorf("target %d should be %s: %s\n", idx, e, targets[idx])
+		}
+	}
+}
+
+func TestTargets_NoMatch(t *testing.T) {
+	dir, _ := createTempFiles(t, "targets_nomatch", []string{
+		"test.conf",
+		"test.conf.orig",
+	})
+	defer os.RemoveAll(dir)
+
+	r := Recipe{File: path.Join(dir, "*.orig")}
+	_, err := r.Targets()
+	if err == nil {
+		t.Errorf("pattern should not match auxiliary files\n")
+	}
+}
+
+func TestRead_Metadata(t *testing.T) {
+	filename := writeRecipe(t, `
+name: "sshd"
+description: "Harden the SSH daemon"
+tags: ["ssh", "hardening"]
+file: "/etc/ssh/sshd_config"`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	if err != nil {
+		t.Errorf("could not read recipe: %s\n", err)
+	}
+
+	if r.Name != "sshd" {
+		t.Errorf("name was not read correctly: %s\n", r.Name)
+	} else if r.Description != "Harden the SSH daemon" {
+		t.Errorf("description was not read correctly: %s\n", r.Description)
+	} else if len(r.Tags) != 2 || !r.HasTag("ssh") || !r.HasTag("hardening") {
+		t.Errorf("tags were not read correctly: %v\n", r.Tags)
+	}
+}
+
+func TestRead_DefaultName(t *testing.T) {
+	filename := writeRecipe(t, "file: '/etc/test.conf'")
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	if err != nil {
+		t.Errorf("could not read recipe: %s\n", err)
+	}
+
+	base := path.Base(filename)
+	if r.Name != strings.TrimSuffix(base, path.Ext(base)) {
+		t.Errorf("name should default to the filename: %s\n", r.Name)
+	}
+}
+
+func TestValidateErrs_DuplicateID(t *testing.T) {
+	r := Recipe{
+		File:    "/etc/test.conf",
+		Delete:  []DeleteEntry{{ID: "same", Search: "remove"}},
+		Replace: []ReplaceEntry{{ID: "same", Search: "pattern"}, {ID: "other", Search: "pattern"}},
+	}
+	errs, warns := r.Validate()
+	if len(errs) != 1 {
+		t.Errorf("unexpected number of errors: %d\n", len(errs))
+	} else if len(warns) != 0 {
+		t.Errorf("unexpected number of warnings: %d\n", len(warns))
+	}
+}
+
+func TestCompile_Labels(t *testing.T) {
+	r := Recipe{
+		Delete:  []DeleteEntry{{Search: "a"}, {ID: "named", Search: "b"}},
+		Replace: []ReplaceEntry{{Search: "c"}},
+	}
+	r.Compile()
+
+	if r.Delete[0].Label() != "delete[0]" {
+		t.Errorf("unexpected label: %s\n", r.Delete[0].Label())
+	} else if r.Delete[1].Label() != "named" {
+		t.Errorf("unexpected label: %s\n", r.Delete[1].Label())
+	} else if r.Replace[0].Label() != "replace[0]" {
+		t.Errorf("unexpected label: %s\n", r.Replace[0].Label())
+	}
+}
+
+func TestValidateErrs_InvalidID(t *testing.T) {
+	r := Recipe{
+		File:   "/etc/test.conf",
+		Delete: []DeleteEntry{{ID: "delete[1]", Search: "remove"}},
+	}
+	errs, _ := r.Validate()
+	if len(errs) != 1 {
+		t.Errorf("unexpected number of errors: %d\n", len(errs))
+	}
+}
+
+func checkErrors(t *testing.T, errs []error, expected []string) {
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors %v: %v\n", expected, errs)
+	}
+	for idx, e := range expected {
+		if errs[idx].Error() != e {
+			t.Errorf("error %d should be '%s': %s\n", idx, e, errs[idx])
+		}
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	filename := writeRecipe(t, `
+file: "/etc/test.conf"
+unknown: "key"
+
+delete:
+  -
+    search: "remove"
+    checkCount: "one"
+  -
+    search: "remove"
+    context: "context"
+
+replace:
+  -
+    search: "pattern"
+    replace: "substitution"
+    replace2: "substitution"`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors: %v\n", err)
+	}
+	checkErrors(t, errs, []string{
+		filename + ":3:1: Unknown field 'unknown'!",
+		filename + ":8:17: delete[0].checkCount: Expected an integer!",
+		filename + ":11:14: delete[1].context: Expected a mapping!",
+		filename + ":17:5: replace[0]: Unknown field 'replace2'!",
+	})
+}
+
+func TestRead_CompileErrors(t *testing.T) {
+	filename := writeRecipe(t, `
+delete:
+  -
+    search: "("
+    context:
+      begin: "["
+
+replace:
+  -
+    id: "named"
+    search: "ok"
+    context:
+      end: "*"
+    checkCount: -1`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors: %v\n", err)
+	}
+	// Problems found by validation are reported together with the patterns.
+	checkErrors(t, errs, []string{
+		filename + ":4:13: delete[0].search: error parsing regexp: missing closing ): `(`",
+		filename + ":6:14: delete[0].context.begin: error parsing regexp: missing closing ]: `[`",
+		filename + ":13:12: named.context.end: error parsing regexp: missing argument to repetition operator: `*`",
+		filename + ": file: Cannot have empty filename!",
+		filename + ":14:17: named.checkCount: Cannot have negative count!",
+	})
+}
+
+func TestValidate_Positions(t *testing.T) {
+	filename := writeRecipe(t, `
+file: "relative.conf"
+tags: ["tag", ""]
+
+replace:
+  -
+    search: ""
+    checkCount: -1
+  -
+    id: "same"
+    search: "pattern"
+  -
+    id: "same"
+    search: "pattern"`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+
+	errs, warns := r.Validate()
+	checkErrors(t, errs, []string{
+		filename + ":3:15: tags[1]: Cannot have empty tag!",
+		filename + ":7:13: replace[0].search: Cannot have empty regex!",
+		filename + ":8:17: replace[0].checkCount: Cannot have negative count!",
+		filename + ":13:9: replace[2].id: Duplicate id 'same'!",
+	})
+	checkErrors(t, warns, []string{
+		filename + ":2:7: file: File should reference an absolute path!",
+	})
+}
+
+func TestDecode(t *testing.T) {
+	var r Recipe
+	err := r.Decode(strings.NewReader("file: '/etc/test.conf'\ndelete: [{search: 'remove'}]"))
+	if err != nil {
+		t.Fatalf("could not decode recipe: %s\n", err)
+	}
+	if r.File != "/etc/test.conf" || len(r.Delete) != 1 || r.Delete[0].SearchRegexp == nil {
+		t.Errorf("recipe was not decoded correctly: %v\n", r)
+	}
+	if r.Name != InputName {
+		t.Errorf("recipe should be named %s: %s\n", InputName, r.Name)
+	}
+
+	err = r.Decode(strings.NewReader("file: '/etc/test.conf'\nunknown: 'key'"))
+	if err == nil || err.Error() != InputName+":2:1: Unknown field 'unknown'!" {
+		t.Errorf("unexpected error: %v\n", err)
+	}
+}
+
+func TestDecodeFormat_BaseDir(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"base.yml": baseRecipe,
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.DecodeFormat(strings.NewReader(`{"extends": "base.yml", "file": "test.conf", "files": ["/etc/abs.conf", "conf.d/*.conf"]}`), FormatJSON, dir)
+	if err != nil {
+		t.Fatalf("could not decode recipe: %s\n", err)
+	}
+	if r.File != path.Join(dir, "test.conf") {
+		t.Errorf("file should be resolved against the base directory: %s\n", r.File)
+	}
+	if len(r.Files) != 2 || r.Files[0] != "/etc/abs.conf" || r.Files[1] != path.Join(dir, "conf.d/*.conf") {
+		t.Errorf("files should be resolved against the base directory: %v\n", r.Files)
+	}
+	if len(r.Delete) != 2 {
+		t.Errorf("entries should be inherited: %v\n", r.Delete)
+	}
+
+	_, warns := r.Validate()
+	if len(warns) != 0 {
+		t.Errorf("resolved files should not be relative: %v\n", warns)
+	}
+}
+
+func TestValidateErrs_Create(t *testing.T) {
+	filename := writeRecipe(t, `file: "/etc/*.conf"
+files: ["/etc/test.conf", "/etc/test.d/*"]
+create: true
+mode: "999"`)
+	defer os.Remove(filename)
+
+	var r Recipe
+	err := r.Read(filename)
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+
+	errs, _ := r.Validate()
+	checkErrors(t, errs, []string{
+		filename + ":1:7: file: Cannot create files matching a glob!",
+		filename + ":2:27: files[1]: Cannot create files matching a glob!",
+		filename + ":4:7: mode: Invalid mode '999', expected an octal number like '0644'!",
+	})
+
+	r = Recipe{File: "/etc/test.conf", Template: "template"}
+	errs, _ = r.Validate()
+	checkErrors(t, errs, []string{
+		"template: Cannot have a template without 'create'!",
+	})
+}
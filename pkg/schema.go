@@ -0,0 +1,165 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Descriptions of all keys in a recipe, indexed by the type and the key.
+var schemaDescriptions = map[string]string{
+	"recipeFile.extends": "Base recipe to inherit from, relative to the directory of this recipe.",
+	"recipeFile.remove":  "Ids of inherited entries to remove.",
+
+	"Recipe.version":     "Version of the recipe format, 1 if omitted.",
+	"Recipe.name":        "Name of the recipe, defaults to the filename without directory and extension.",
+	"Recipe.description": "Description of the recipe.",
+	"Recipe.tags":        "Tags to select the recipe with '--tag'.",
+	"Recipe.after":       "Names of recipes that must be applied before this one.",
+	"Recipe.file":        "Configuration file to produce, may be a glob.",
+	"Recipe.files":       "Additional configuration files to produce, may be globs.",
+	"Recipe.delete":      "Lines to delete.",
+	"Recipe.replace":     "Substitutions in lines.",
+	"Recipe.append":      "Lines to append at the end of the file.",
+	"Recipe.create":      "Create the file if it does not exist.",
+	"Recipe.template":    "Input to create the file from, empty if omitted.",
+	"Recipe.mode":        "Mode of the file as an octal number, enforced on every write.",
+	"Recipe.owner":       "Owner of the file by name or id, enforced on every write.",
+	"Recipe.group":       "Group of the file by name or id, enforced on every write.",
+
+	"DeleteEntry.id":         "Identifies the entry in diagnostics and for recipes extending this one.",
+	"DeleteEntry.context":    "Restricts the entry to a part of the file.",
+	"DeleteEntry.search":     "Regular expression matching the lines to delete.",
+	"DeleteEntry.checkCount": "Expected number of deleted lines, 0 to not check.",
+
+	"ReplaceEntry.id":         "Identifies the entry in diagnostics and for recipes extending this one.",
+	"ReplaceEntry.context":    "Restricts the entry to a part of the file.",
+	"ReplaceEntry.search":     "Regular expression to search for.",
+	"ReplaceEntry.replace":    "Replacement for all matches, may reference capture groups like $1 or ${name}.",
+	"ReplaceEntry.checkCount": "Expected number of replacements, 0 to not check.",
+
+	"Context.begin": "Regular expression for the line that begins the context, omit to begin in the first line.",
+	"Context.end":   "Regular expression for the line that ends the context, omit to end at the last line.",
+}
+
+// Additional constraints for keys that are not expressed by their type.
+var schemaConstraints = map[string]map[string]interface{}{
+	"Recipe.version":          {"minimum": 1, "maximum": CurrentVersion},
+	"Recipe.mode":             {"pattern": modeRegexp.String()},
+	"DeleteEntry.id":          {"pattern": idRegexp.String()},
+	"DeleteEntry.search":      {"minLength": 1},
+	"DeleteEntry.checkCount":  {"minimum": 0},
+	"ReplaceEntry.id":         {"pattern": idRegexp.String()},
+	"ReplaceEntry.search":     {"minLength": 1},
+	"ReplaceEntry.checkCount": {"minimum": 0},
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// Return the schema for a value of type t.
+func (g *schemaGenerator) typeSchema(t reflect.Type) (map[string]interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Slice:
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Struct:
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// Reserve the name to handle recursive types.
+			g.definitions[t.Name()] = nil
+			def, err := g.objectSchema(t)
+			if err != nil {
+				return nil, err
+			}
+			g.definitions[t.Name()] = def
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}, nil
+	}
+	return nil, fmt.Errorf("Cannot generate schema for type %s!", t)
+}
+
+// Add the properties of struct type t to properties, including inlined structs.
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]interface{}) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isInline(f) {
+			err := g.addProperties(f.Type, properties)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if f.PkgPath != "" || f.Tag.Get("yaml") == "-" {
+			continue
+		}
+
+		key := fieldKey(f)
+		name := t.Name() + "." + key
+		description, ok := schemaDescriptions[name]
+		if !ok {
+			return fmt.Errorf("No description for %s!", name)
+		}
+
+		schema, err := g.typeSchema(f.Type)
+		if err != nil {
+			return err
+		}
+		if _, isRef := schema["$ref"]; isRef {
+			// Keywords next to $ref are ignored in draft-07.
+			schema = map[string]interface{}{"allOf": []interface{}{schema}}
+		}
+		schema["description"] = description
+		for k, v := range schemaConstraints[name] {
+			schema[k] = v
+		}
+		properties[key] = schema
+	}
+	return nil
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	err := g.addProperties(t, properties)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, nil
+}
+
+// Schema returns a JSON Schema describing recipes, for use in editors and
+// other tools.
+func Schema() ([]byte, error) {
+	g := schemaGenerator{definitions: make(map[string]interface{})}
+	schema, err := g.objectSchema(reflect.TypeOf(recipeFile{}))
+	if err != nil {
+		return nil, err
+	}
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = "https://github.com/hahnjo/dynconf/recipe.schema.json"
+	schema["title"] = "DynConf recipe"
+	schema["definitions"] = g.definitions
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("could not generate schema: %s\n", err)
+	}
+
+	var schema struct {
+		Properties  map[string]interface{}
+		Definitions map[string]struct {
+			Properties map[string]interface{}
+		}
+	}
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		t.Fatalf("schema is not valid JSON: %s\n", err)
+	}
+
+	// Every description must belong to a key that is in the schema.
+	properties := map[string]map[string]interface{}{
+		"recipeFile": schema.Properties,
+		"Recipe":     schema.Properties,
+	}
+	for name, def := range schema.Definitions {
+		properties[name] = def.Properties
+	}
+	for name := range schemaDescriptions {
+		parts := strings.SplitN(name, ".", 2)
+		if _, ok := properties[parts[0]][parts[1]]; !ok {
+			t.Errorf("description for %s which is not in the schema\n", name)
+		}
+	}
+	for name := range schemaConstraints {
+		if _, ok := schemaDescriptions[name]; !ok {
+			t.Errorf("constraints for %s which is not in the schema\n", name)
+		}
+	}
+
+	for _, key := range []string{"name", "file", "delete", "replace", "append", "extends", "remove"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("key '%s' is missing from the schema\n", key)
+		}
+	}
+	for _, name := range []string{"DeleteEntry", "ReplaceEntry", "Context"} {
+		if _, ok := schema.Definitions[name]; !ok {
+			t.Errorf("definition '%s' is missing from the schema\n", name)
+		}
+	}
+}
+
+func TestSchema_InSync(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("could not generate schema: %s\n", err)
+	}
+
+	committed, err := ioutil.ReadFile("../recipe.schema.json")
+	if err != nil {
+		t.Fatalf("could not read recipe.schema.json: %s\n", err)
+	}
+	if !bytes.Equal(data, committed) {
+		t.Errorf("recipe.schema.json is out of date, run 'make schema'\n")
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsFile is the default location of the settings for DynConf.
+var SettingsFile = "/etc/dynconf.conf"
+
+// DetectorSettings enables a detector. Either Name refers to one of
+// KnownDetectors, or Suffixes or Prefixes define a new detector with Name.
+type DetectorSettings struct {
+	Name     string   `yaml:"name"`
+	Suffixes []string `yaml:"suffixes,omitempty"`
+	Prefixes []string `yaml:"prefixes,omitempty"`
+}
+
+// UnmarshalYAML accepts a single name in place of a mapping.
+func (d *DetectorSettings) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		d.Name = n.Value
+		return nil
+	}
+
+	// Avoid recursion into this method.
+	type plain DetectorSettings
+	return n.Decode((*plain)(d))
+}
+
+// Settings for DynConf that are not specific to recipes.
+type Settings struct {
+	// Detectors to enable in order of priority. If empty, the detectors in
+	// DefaultDetectors are enabled.
+	Detectors []DetectorSettings `yaml:"detectors,omitempty"`
+	// Prefer decides which update file is used if there are several, see
+	// the variable Prefer.
+	Prefer string `yaml:"prefer,omitempty"`
+	// StateDir is the directory for the unmodified copies of configuration
+	// files. If empty, DefaultStateDir is used.
+	StateDir string `yaml:"stateDir,omitempty"`
+	// Generations is the number of generations to keep for every
+	// configuration file. If nil, the value of the variable Generations is
+	// kept.
+	Generations *int `yaml:"generations,omitempty"`
+	// Xattrs lists patterns of the extended attributes to copy when
+	// replacing a file. If nil, the value of the variable Xattrs is kept.
+	Xattrs []string `yaml:"xattrs,omitempty"`
+}
+
+// LoadSettings reads the settings in filename. If the file does not exist,
+// the result contains the defaults.
+func LoadSettings(filename string) (*Settings, error) {
+	var s Settings
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return &s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	err = dec.Decode(&s)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Return the detectors enabled by the settings.
+func (s *Settings) detectors() ([]Detector, error) {
+	if len(s.Detectors) == 0 {
+		return defaultDetectors(), nil
+	}
+
+	detectors := make([]Detector, 0, len(s.Detectors))
+	for idx, d := range s.Detectors {
+		switch {
+		case d.Name == "":
+			return nil, fmt.Errorf("Detector %d needs a name!", idx+1)
+		case len(d.Suffixes) > 0 && len(d.Prefixes) > 0:
+			return nil, fmt.Errorf("Detector '%s' cannot have both suffixes and prefixes!", d.Name)
+		case len(d.Suffixes) > 0:
+			detectors = append(detectors, NewSuffixDetector(d.Name, d.Suffixes...))
+		case len(d.Prefixes) > 0:
+			detectors = append(detectors, NewPrefixDetector(d.Name, d.Prefixes...))
+		default:
+			known, ok := KnownDetectors[d.Name]
+			if !ok {
+				return nil, fmt.Errorf("Unknown detector '%s'!", d.Name)
+			}
+			detectors = append(detectors, known)
+		}
+	}
+	return detectors, nil
+}
+
+// Apply makes the settings effective for this package.
+func (s *Settings) Apply() error {
+	detectors, err := s.detectors()
+	if err != nil {
+		return err
+	}
+
+	switch s.Prefer {
+	case "", PreferNewest, PreferPriority:
+	default:
+		found := false
+		for _, d := range detectors {
+			found = found || d.Name() == s.Prefer
+		}
+		if !found {
+			return fmt.Errorf("Cannot prefer '%s', expected newest, priority, or the name of an enabled detector!", s.Prefer)
+		}
+	}
+
+	stateDir := s.StateDir
+	if stateDir == "" {
+		stateDir = DefaultStateDir
+	} else if !filepath.IsAbs(stateDir) {
+		return fmt.Errorf("State directory '%s' must be an absolute path!", stateDir)
+	}
+
+	if s.Generations != nil && *s.Generations < 0 {
+		return fmt.Errorf("Number of generations must not be negative!")
+	}
+
+	for _, pattern := range s.Xattrs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid pattern '%s' for extended attributes!", pattern)
+		}
+	}
+
+	Detectors = detectors
+	Prefer = s.Prefer
+	StateDir = stateDir
+	if s.Generations != nil {
+		Generations = *s.Generations
+	}
+	if s.Xattrs != nil {
+		Xattrs = s.Xattrs
+	}
+	return nil
+}
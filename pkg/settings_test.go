@@ -0,0 +1,106 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadSettings_Missing(t *testing.T) {
+	s, err := LoadSettings("/nonexistent/dynconf.conf")
+	if err != nil {
+		t.Fatalf("missing settings should not be an error: %s\n", err)
+	}
+
+	detectors, err := s.detectors()
+	if err != nil {
+		t.Fatalf("could not get detectors: %s\n", err)
+	}
+	if len(detectors) != len(DefaultDetectors) {
+		t.Errorf("default detectors should be enabled: %v\n", detectors)
+	}
+}
+
+func TestLoadSettings_Detectors(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"dynconf.conf": `
+detectors:
+  - "dpkg"
+  - name: "custom"
+    suffixes: [".dist"]
+  - name: "prefix"
+    prefixes: [".new."]`,
+	})
+	defer os.RemoveAll(dir)
+
+	s, err := LoadSettings(path.Join(dir, "dynconf.conf"))
+	if err != nil {
+		t.Fatalf("could not load settings: %s\n", err)
+	}
+
+	defer func(detectors []Detector, stateDir string) {
+		Detectors, StateDir = detectors, stateDir
+	}(Detectors, StateDir)
+	err = s.Apply()
+	if err != nil {
+		t.Fatalf("could not apply settings: %s\n", err)
+	}
+
+	names := make([]string, 0)
+	for _, d := range Detectors {
+		names = append(names, d.Name())
+	}
+	if strings.Join(names, ",") != "dpkg,custom,prefix" {
+		t.Errorf("unexpected detectors: %v\n", names)
+	}
+	if StateDir != DefaultStateDir {
+		t.Errorf("default state directory should be used: %s\n", StateDir)
+	}
+
+	if !isAuxiliary("/etc/test.conf.dist") || !isAuxiliary("/etc/.new.test.conf") {
+		t.Errorf("files of custom detectors should be auxiliary\n")
+	}
+	if isAuxiliary("/etc/test.conf.pacnew") {
+		t.Errorf("files of disabled detectors should not be auxiliary\n")
+	}
+}
+
+func TestLoadSettings_Errors(t *testing.T) {
+	dir := writeRecipes(t, map[string]string{
+		"unknown.conf":    "detectors: ['unknown']",
+		"noName.conf":     "detectors: [{suffixes: ['.new']}]",
+		"both.conf":       "detectors: [{name: 'both', suffixes: ['.new'], prefixes: ['.new.']}]",
+		"unknownKey.conf": "unknown: 'key'",
+		"prefer.conf":     "detectors: ['dpkg']\nprefer: 'rpm'",
+		"stateDir.conf":   "stateDir: 'var/lib/dynconf'",
+		"negative.conf":   "generations: -1",
+		"xattrs.conf":     "xattrs: ['user.[']",
+	})
+	defer os.RemoveAll(dir)
+
+	for name, msg := range map[string]string{
+		"unknown.conf":    "Unknown detector 'unknown'!",
+		"noName.conf":     "Detector 1 needs a name!",
+		"both.conf":       "Detector 'both' cannot have both suffixes and prefixes!",
+		"unknownKey.conf": "yaml: unmarshal errors:\n  line 1: field unknown not found in type dynconf.Settings",
+		"prefer.conf":     "Cannot prefer 'rpm', expected newest, priority, or the name of an enabled detector!",
+		"stateDir.conf":   "State directory 'var/lib/dynconf' must be an absolute path!",
+		"negative.conf":   "Number of generations must not be negative!",
+		"xattrs.conf":     "Invalid pattern 'user.[' for extended attributes!",
+	} {
+		defer func(detectors []Detector, prefer string) {
+			Detectors, Prefer = detectors, prefer
+		}(Detectors, Prefer)
+
+		s, err := LoadSettings(path.Join(dir, name))
+		if err == nil {
+			err = s.Apply()
+		}
+		if err == nil || err.Error() != msg {
+			t.Errorf("unexpected error for %s: %v\n", name, err)
+		}
+	}
+}
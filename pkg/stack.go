@@ -0,0 +1,233 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Target is a configuration file together with all recipes that apply to it,
+// in the order they should be applied.
+type Target struct {
+	File    string
+	Recipes []Recipe
+}
+
+func (r *Recipe) sortKey() string {
+	if r.filename != "" {
+		return r.baseName()
+	}
+	return r.Name
+}
+
+// SortRecipes orders recipes by their filename without directory and
+// extension, or by their name if they were not read from a file. Recipes
+// listing the names of other recipes in After are moved behind them. Names in
+// After that do not refer to one of the given recipes are ignored.
+func SortRecipes(recipes []Recipe) ([]Recipe, error) {
+	sorted := make([]Recipe, len(recipes))
+	copy(sorted, recipes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].sortKey() < sorted[j].sortKey()
+	})
+
+	names := make(map[string]bool)
+	for _, r := range sorted {
+		names[r.Name] = true
+	}
+
+	// Repeatedly pick the first recipe that has all dependencies applied.
+	result := make([]Recipe, 0, len(sorted))
+	done := make(map[string]bool)
+	remaining := sorted
+	for len(remaining) > 0 {
+		picked := -1
+		for idx, r := range remaining {
+			ready := true
+			for _, a := range r.After {
+				if names[a] && !done[a] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				picked = idx
+				break
+			}
+		}
+
+		if picked == -1 {
+			cycle := make([]string, 0, len(remaining))
+			for _, r := range remaining {
+				cycle = append(cycle, r.Name)
+			}
+			return nil, fmt.Errorf("Recipes %s have cyclic dependencies!", strings.Join(cycle, ", "))
+		}
+
+		r := remaining[picked]
+		result = append(result, r)
+		done[r.Name] = true
+		remaining = append(remaining[:picked:picked], remaining[picked+1:]...)
+	}
+
+	return result, nil
+}
+
+// GroupTargets sorts the recipes and expands their files. The recipes are
+// then grouped by the configuration files they apply to, in the order that
+// the files were first named.
+func GroupTargets(recipes []Recipe) ([]Target, error) {
+	return groupTargets(recipes, true)
+}
+
+// GroupExistingTargets groups the recipes like GroupTargets, but skips globs
+// that do not match any file instead of failing.
+func GroupExistingTargets(recipes []Recipe) ([]Target, error) {
+	return groupTargets(recipes, false)
+}
+
+// Group the recipes by target, see GroupTargets and Recipe.targets for strict.
+func groupTargets(recipes []Recipe, strict bool) ([]Target, error) {
+	sorted, err := SortRecipes(recipes)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0)
+	index := make(map[string]int)
+	for _, r := range sorted {
+		files, err := r.targets(strict)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			idx, ok := index[f]
+			if !ok {
+				idx = len(targets)
+				index[f] = idx
+				targets = append(targets, Target{File: f})
+			}
+			targets[idx].Recipes = append(targets[idx].Recipes, r)
+		}
+	}
+
+	return targets, nil
+}
+
+// Create returns whether one of the recipes creates the configuration file,
+// and the template to create it from. It is an error if the recipes declare
+// different templates.
+func (t *Target) Create() (bool, []byte, error) {
+	create := false
+	template, from := "", ""
+	for _, r := range t.Recipes {
+		create = create || r.Create
+		if r.Template == "" {
+			continue
+		} else if from != "" && r.Template != template {
+			return false, nil, fmt.Errorf("Recipes '%s' and '%s' declare different templates for %s!", from, r.Name, t.File)
+		}
+		template, from = r.Template, r.Name
+	}
+	return create, []byte(template), nil
+}
+
+// Attributes returns the mode and owners declared by the recipes. It is an
+// error if the recipes declare different values.
+func (t *Target) Attributes() (FileAttributes, error) {
+	var attrs FileAttributes
+	from := make(map[string]string)
+	merge := func(field string, value string, dst *string, r *Recipe) error {
+		if value == "" {
+			return nil
+		} else if *dst != "" && *dst != value {
+			return fmt.Errorf("Recipes '%s' and '%s' declare different %s for %s!", from[field], r.Name, field, t.File)
+		}
+		*dst, from[field] = value, r.Name
+		return nil
+	}
+	for idx := range t.Recipes {
+		r := &t.Recipes[idx]
+		for _, err := range []error{
+			merge("mode", r.Mode, &attrs.Mode, r),
+			merge("owner", r.Owner, &attrs.Owner, r),
+			merge("group", r.Group, &attrs.Group, r),
+		} {
+			if err != nil {
+				return FileAttributes{}, err
+			}
+		}
+	}
+	return attrs, nil
+}
+
+func ApplyStackToFile(recipes []Recipe, filename string) ([]byte, []byte, []error) {
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	modified, errs := ApplyStackToInput(recipes, input)
+	return input, modified, errs
+}
+
+// ApplyStackToInput applies all recipes in order, each one working on the
+// output of the previous one. It is an error if two recipes delete or replace
+// in the same line of the input.
+func ApplyStackToInput(recipes []Recipe, input []byte) ([]byte, []error) {
+	modified, _, errs := TraceStackInput(recipes, input)
+	return modified, errs
+}
+
+// TraceStackInput applies the recipes like ApplyStackToInput and additionally
+// returns all deletions and replacements. Line numbers of the events refer to
+// the unmodified input.
+func TraceStackInput(recipes []Recipe, input []byte) ([]byte, []Event, []error) {
+	if len(recipes) == 1 {
+		return TraceInput(recipes[0], input)
+	}
+
+	errs := make([]error, 0)
+
+	// Find out which lines of the input each recipe touches. Recipes are
+	// identified by their index because names need not be unique.
+	type owner struct {
+		recipe int
+		event  Event
+	}
+	trace := make([]Event, 0)
+	owners := make(map[int]owner)
+	reported := make(map[int]bool)
+	for idx, r := range recipes {
+		_, events, _ := TraceInput(r, input)
+		trace = append(trace, events...)
+
+		for _, e := range events {
+			other, ok := owners[e.Line]
+			if !ok {
+				owners[e.Line] = owner{idx, e}
+			} else if other.recipe != idx && !reported[e.Line] {
+				reported[e.Line] = true
+				errs = append(errs, fmt.Errorf("Entries '%s' of recipe '%s' and '%s' of recipe '%s' both modify line %d!", other.event.Entry, other.event.Recipe, e.Entry, e.Recipe, e.Line))
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return nil, trace, errs
+	}
+
+	modified := input
+	for _, r := range recipes {
+		var rErrs []error
+		modified, rErrs = ApplyToInput(r, modified)
+		for _, e := range rErrs {
+			errs = append(errs, fmt.Errorf("%s: %s", r.Name, e))
+		}
+	}
+
+	return modified, trace, errs
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func namedRecipe(name string, r Recipe) Recipe {
+	r.Name = name
+	r.filename = "/recipes/" + name + ".yml"
+	r.Compile()
+	return r
+}
+
+func recipeNames(recipes []Recipe) []string {
+	names := make([]string, 0, len(recipes))
+	for _, r := range recipes {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func checkNames(t *testing.T, recipes []Recipe, expected []string) {
+	names := recipeNames(recipes)
+	if len(names) != len(expected) {
+		t.Fatalf("expected recipes %v: %v\n", expected, names)
+	}
+	for idx, e := range expected {
+		if names[idx] != e {
+			t.Errorf("expected recipes %v: %v\n", expected, names)
+			return
+		}
+	}
+}
+
+func TestSortRecipes(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("20-b", Recipe{}),
+		namedRecipe("10-a", Recipe{}),
+		namedRecipe("30-c", Recipe{}),
+	}
+
+	sorted, err := SortRecipes(recipes)
+	if err != nil {
+		t.Fatalf("could not sort recipes: %s\n", err)
+	}
+	checkNames(t, sorted, []string{"10-a", "20-b", "30-c"})
+}
+
+func TestSortRecipes_After(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{After: []string{"c"}}),
+		namedRecipe("b", Recipe{After: []string{"unknown"}}),
+		namedRecipe("c", Recipe{After: []string{"b"}}),
+	}
+
+	sorted, err := SortRecipes(recipes)
+	if err != nil {
+		t.Fatalf("could not sort recipes: %s\n", err)
+	}
+	checkNames(t, sorted, []string{"b", "c", "a"})
+}
+
+func TestSortRecipes_Cycle(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{After: []string{"b"}}),
+		namedRecipe("b", Recipe{After: []string{"a"}}),
+	}
+
+	_, err := SortRecipes(recipes)
+	if err == nil {
+		t.Errorf("cyclic dependencies should be detected\n")
+	}
+}
+
+func TestGroupTargets(t *testing.T) {
+	dir, filenames := createTempFiles(t, "group", []string{
+		"a.conf",
+		"b.conf",
+	})
+	defer os.RemoveAll(dir)
+
+	recipes := []Recipe{
+		namedRecipe("second", Recipe{File: filenames[0]}),
+		namedRecipe("first", Recipe{File: path.Join(dir, "*.conf")}),
+	}
+
+	targets, err := GroupTargets(recipes)
+	if err != nil {
+		t.Fatalf("could not group targets: %s\n", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("unexpected number of targets: %d\n", len(targets))
+	}
+	if targets[0].File != filenames[0] {
+		t.Errorf("first target should be %s: %s\n", filenames[0], targets[0].File)
+	}
+	checkNames(t, targets[0].Recipes, []string{"first", "second"})
+	if targets[1].File != filenames[1] {
+		t.Errorf("second target should be %s: %s\n", filenames[1], targets[1].File)
+	}
+	checkNames(t, targets[1].Recipes, []string{"first"})
+}
+
+func TestGroupExistingTargets(t *testing.T) {
+	dir, filenames := createTempFiles(t, "group_existing", []string{
+		"a.conf",
+	})
+	defer os.RemoveAll(dir)
+
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{File: filenames[0]}),
+		namedRecipe("b", Recipe{Files: []string{path.Join(dir, "*.missing"), filenames[0]}}),
+	}
+	_, err := GroupTargets(recipes)
+	if err == nil {
+		t.Errorf("glob without match should fail\n")
+	}
+
+	targets, err := GroupExistingTargets(recipes)
+	if err != nil {
+		t.Fatalf("could not group targets: %s\n", err)
+	}
+	if len(targets) != 1 || targets[0].File != filenames[0] {
+		t.Fatalf("unexpected targets: %v\n", targets)
+	}
+	checkNames(t, targets[0].Recipes, []string{"a", "b"})
+}
+
+func TestApplyStack(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{
+			Delete:  []DeleteEntry{{Search: "remove"}},
+			Replace: []ReplaceEntry{{Search: "first", Replace: "1st", CheckCount: 1}},
+			Append:  "appended",
+		}),
+		namedRecipe("b", Recipe{
+			Replace: []ReplaceEntry{{Search: "second|appended", Replace: "2nd", CheckCount: 2}},
+		}),
+	}
+
+	modified, errs := ApplyStackToInput(recipes, []byte("first\nremove\nsecond\n"))
+	if len(errs) != 0 {
+		t.Fatalf("did not expect errors: %v\n", errs)
+	}
+	if string(modified) != "1st\n2nd\n2nd\n" {
+		t.Errorf("recipes should have been applied in order: %s\n", modified)
+	}
+}
+
+func TestApplyStack_Conflict(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{
+			Replace: []ReplaceEntry{{Search: "value", Replace: "a"}},
+		}),
+		namedRecipe("b", Recipe{
+			Delete: []DeleteEntry{{Search: "key"}},
+		}),
+	}
+
+	_, errs := ApplyStackToInput(recipes, []byte("other\nkey = value\n"))
+	if len(errs) != 1 {
+		t.Errorf("expected one conflict: %v\n", errs)
+	}
+
+	// Names are not unique, and every line is reported once.
+	recipes = append(recipes, namedRecipe("b", Recipe{
+		Replace: []ReplaceEntry{{Search: "key", Replace: "b"}},
+	}))
+	recipes[1].Name = "a"
+	_, errs = ApplyStackToInput(recipes, []byte("other\nkey = value\n"))
+	if len(errs) != 1 || errs[0].Error() != "Entries 'replace[0]' of recipe 'a' and 'delete[0]' of recipe 'a' both modify line 2!" {
+		t.Errorf("expected one conflict: %v\n", errs)
+	}
+}
+
+func TestApplyStack_CheckCount(t *testing.T) {
+	recipes := []Recipe{
+		namedRecipe("a", Recipe{
+			Replace: []ReplaceEntry{{Search: "a", Replace: "b"}},
+		}),
+		namedRecipe("b", Recipe{
+			Delete: []DeleteEntry{{Search: "b", CheckCount: 2}},
+		}),
+	}
+
+	_, errs := ApplyStackToInput(recipes, []byte("a\n"))
+	if len(errs) != 1 {
+		t.Errorf("expected one error: %v\n", errs)
+	}
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// State describes a configuration file and the files next to it.
+type State string
+
+const (
+	// The configuration file does not exist.
+	StateMissing State = "missing"
+	// DynConf has not modified the configuration file.
+	StateUnmanaged State = "unmanaged"
+	// DynConf has modified the configuration file and keeps an unmodified
+	// copy.
+	StateApplied State = "applied"
+	// The package manager installed an update file.
+	StateUpdate State = "update"
+	// The package was removed and the package manager saved the
+	// configuration file.
+	StateRemoved State = "removed"
+	// The package was reinstalled and the package manager saved the modified
+	// configuration file. The unmodified copy is stale.
+	StateReinstalled State = "reinstalled"
+)
+
+// Drift is the result of comparing a configuration file with the output of
+// its recipes.
+type Drift string
+
+const (
+	// The configuration file is the output of the recipes.
+	DriftUpToDate Drift = "up-to-date"
+	// The configuration file was modified since the recipes were applied.
+	DriftDrifted Drift = "drifted"
+	// The package manager installed an update file that was not applied yet.
+	DriftPendingUpdate Drift = "pending-upstream-update"
+	// There is no unmodified copy, so the recipes were not applied yet or the
+	// copy was lost.
+	DriftMissingOrig Drift = "missing-orig"
+	// The recipes cannot be applied to the input.
+	DriftRecipeFailing Drift = "recipe-failing"
+	// The configuration file is the output of the recipes, but its mode or
+	// owners differ from the declared ones or cannot be resolved, see Declare.
+	DriftAttributes Drift = "wrong-attributes"
+)
+
+// SavePolicy decides how to reconcile a file saved by the package manager.
+type SavePolicy string
+
+const (
+	// Move the saved file back in place of the configuration file.
+	SaveRestore SavePolicy = "restore"
+	// Remove the saved file and the unmodified copy.
+	SaveDiscard SavePolicy = "discard"
+	// Keep the saved file for reference and the configuration file as it is,
+	// but remove the unmodified copy.
+	SaveKeep SavePolicy = "keep"
+)
+
+// ParseSavePolicy returns the SavePolicy with the given name.
+func ParseSavePolicy(name string) (SavePolicy, error) {
+	switch p := SavePolicy(name); p {
+	case SaveRestore, SaveDiscard, SaveKeep:
+		return p, nil
+	}
+	return "", fmt.Errorf("Unknown policy '%s', expected restore, discard, or keep!", name)
+}
+
+func (c *Config) findSaved() {
+	for _, d := range SaveDetectors {
+		if found := d.Find(c.base); len(found) > 0 {
+			c.saved = &found[0]
+			return
+		}
+	}
+}
+
+// Saved returns the file saved by the package manager, or the empty string if
+// there is none.
+func (c *Config) Saved() string {
+	if c.saved == nil {
+		return ""
+	}
+	return *c.saved
+}
+
+// State returns the state of the configuration file.
+func (c *Config) State() State {
+	if c.saved != nil {
+		if !exists(c.base) {
+			return StateRemoved
+		} else if c.orig != nil {
+			return StateReinstalled
+		}
+	}
+	if !exists(c.base) {
+		return StateMissing
+	}
+	if c.new != nil {
+		return StateUpdate
+	} else if c.orig != nil {
+		return StateApplied
+	}
+	return StateUnmanaged
+}
+
+// Reconcile the unmodified copy with the file saved by the package manager
+// according to policy.
+func (c *Config) Reconcile(policy SavePolicy) error {
+	if c.saved == nil {
+		return fmt.Errorf("There is no saved file for %s!", c.base)
+	}
+
+	switch policy {
+	case SaveRestore:
+		if stat, err := os.Stat(c.base); err == nil {
+			// The package manager installed its default, which is the new
+			// unmodified input.
+			data, err := ioutil.ReadFile(c.base)
+			if err != nil {
+				return err
+			}
+			attrs, err := statAttrs(stat)
+			if err != nil {
+				return err
+			}
+			err = c.writeOrig(data, attrs)
+			if err != nil {
+				return err
+			}
+		}
+		err := os.Rename(*c.saved, c.base)
+		if err != nil {
+			return err
+		}
+		c.saved = nil
+	case SaveDiscard:
+		err := os.Remove(*c.saved)
+		if err != nil {
+			return err
+		}
+		c.saved = nil
+		fallthrough
+	case SaveKeep:
+		if c.orig != nil {
+			err := os.Remove(*c.orig)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			c.orig = nil
+		}
+	default:
+		return fmt.Errorf("Unknown policy '%s'!", policy)
+	}
+
+	return nil
+}
+
+// Drift applies recipes to the input and compares the output with the
+// configuration file, and its attributes with the declared ones. If the
+// recipes fail, the errors are returned. If the attributes differ or cannot be
+// resolved, the returned errors describe how, also if the content drifted. If
+// the configuration file cannot be read, it is reported as drifted.
+func (c *Config) Drift(recipes []Recipe) (Drift, []error) {
+	_, expected, errs := ApplyStackToFile(recipes, c.GetInput())
+	if len(errs) != 0 {
+		return DriftRecipeFailing, errs
+	}
+	if c.new != nil {
+		return DriftPendingUpdate, nil
+	} else if c.orig == nil {
+		return DriftMissingOrig, nil
+	}
+
+	current, err := ioutil.ReadFile(c.base)
+	if err != nil {
+		return DriftDrifted, []error{err}
+	}
+	differ, err := c.attrsDiffer()
+	if err != nil {
+		differ = []error{err}
+	}
+	if !bytes.Equal(current, expected) {
+		return DriftDrifted, differ
+	} else if len(differ) > 0 {
+		return DriftAttributes, differ
+	}
+	return DriftUpToDate, nil
+}
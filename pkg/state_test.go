@@ -0,0 +1,212 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func checkState(t *testing.T, c *Config, expected State) {
+	if s := c.State(); s != expected {
+		t.Errorf("state should be %s: %s\n", expected, s)
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, filenames := createTempFiles(t, "state", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+
+	checkState(t, newConfig(t, path.Join(dir, "missing.conf")), StateMissing)
+
+	c := newConfig(t, base)
+	checkState(t, c, StateUnmanaged)
+	commit(t, c)
+	checkState(t, c, StateApplied)
+
+	writeTempFile(t, base+".pacnew", newData)
+	checkState(t, newConfig(t, base), StateUpdate)
+}
+
+// Create the files after a package was removed or reinstalled.
+func createSaved(t *testing.T, prefix string, reinstalled bool) (string, []string) {
+	dir, filenames := createTempFiles(t, prefix, []string{
+		"test.conf",
+		"test.conf.orig",
+		"test.conf.rpmsave",
+	})
+	writeTempFile(t, filenames[1], origData)
+	writeTempFile(t, filenames[2], modifiedData)
+	if reinstalled {
+		writeTempFile(t, filenames[0], newData)
+	} else {
+		os.Remove(filenames[0])
+	}
+	return dir, filenames
+}
+
+func reconcile(t *testing.T, c *Config, policy SavePolicy) {
+	err := c.Reconcile(policy)
+	if err != nil {
+		t.Errorf("could not reconcile: %s\n", err)
+	}
+}
+
+func TestSaved_Removed(t *testing.T) {
+	for _, policy := range []SavePolicy{SaveRestore, SaveDiscard, SaveKeep} {
+		dir, filenames := createSaved(t, "removed", false)
+		defer os.RemoveAll(dir)
+		base, orig, saved := filenames[0], filenames[1], filenames[2]
+
+		c := newConfig(t, base)
+		checkState(t, c, StateRemoved)
+		if s := c.Saved(); s != saved {
+			t.Errorf("saved file should be .rpmsave: %s\n", s)
+		}
+		if !isAuxiliary(saved) {
+			t.Errorf(".rpmsave should be auxiliary\n")
+		}
+
+		reconcile(t, c, policy)
+		switch policy {
+		case SaveRestore:
+			checkState(t, c, StateApplied)
+			checkContent(t, base, modifiedData)
+			checkContent(t, orig, origData)
+		case SaveDiscard:
+			checkState(t, c, StateMissing)
+			if exists(orig) || exists(saved) {
+				t.Errorf(".orig and .rpmsave should have been deleted\n")
+			}
+		case SaveKeep:
+			checkState(t, c, StateRemoved)
+			checkContent(t, saved, modifiedData)
+			if exists(orig) {
+				t.Errorf(".orig should have been deleted\n")
+			}
+		}
+	}
+}
+
+func TestSaved_Reinstalled(t *testing.T) {
+	for _, policy := range []SavePolicy{SaveRestore, SaveDiscard, SaveKeep} {
+		dir, filenames := createSaved(t, "reinstalled", true)
+		defer os.RemoveAll(dir)
+		base, orig, saved := filenames[0], filenames[1], filenames[2]
+
+		c := newConfig(t, base)
+		checkState(t, c, StateReinstalled)
+
+		reconcile(t, c, policy)
+		switch policy {
+		case SaveRestore:
+			checkState(t, c, StateApplied)
+			checkContent(t, base, modifiedData)
+			checkContent(t, orig, newData)
+			if exists(saved) {
+				t.Errorf(".rpmsave should have been moved\n")
+			}
+		case SaveDiscard:
+			checkState(t, c, StateUnmanaged)
+			checkContent(t, base, newData)
+			if exists(orig) || exists(saved) {
+				t.Errorf(".orig and .rpmsave should have been deleted\n")
+			}
+		case SaveKeep:
+			checkState(t, c, StateUnmanaged)
+			checkContent(t, base, newData)
+			checkContent(t, saved, modifiedData)
+			if exists(orig) {
+				t.Errorf(".orig should have been deleted\n")
+			}
+		}
+	}
+}
+
+func TestReconcile_Errors(t *testing.T) {
+	dir, filenames := createTempFiles(t, "reconcile", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+
+	err := newConfig(t, filenames[0]).Reconcile(SaveRestore)
+	if err == nil {
+		t.Errorf("reconciling without saved file should fail\n")
+	}
+
+	_, err = ParseSavePolicy("ignore")
+	if err == nil {
+		t.Errorf("ignore should not be a known policy\n")
+	}
+}
+
+func decodeRecipe(t *testing.T, data string) Recipe {
+	var r Recipe
+	err := r.Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("could not decode recipe: %s\n", err)
+	}
+	return r
+}
+
+func checkDrift(t *testing.T, c *Config, recipes []Recipe, expected Drift) {
+	d, errs := c.Drift(recipes)
+	if d != expected {
+		t.Errorf("drift should be %s: %s %v\n", expected, d, errs)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	dir, filenames := createTempFiles(t, "drift", []string{
+		"test.conf",
+	})
+	defer os.RemoveAll(dir)
+	base := filenames[0]
+	writeTempFile(t, base, []byte("a\n"))
+	recipes := []Recipe{decodeRecipe(t, "file: 'test.conf'\nappend: \"b\\n\"")}
+	failing := []Recipe{decodeRecipe(t, "file: 'test.conf'\ndelete: [{search: 'c', checkCount: 1}]")}
+
+	c := newConfig(t, base)
+	checkDrift(t, c, recipes, DriftMissingOrig)
+	checkDrift(t, c, failing, DriftRecipeFailing)
+	err := c.Commit([]byte("a\n"), []byte("a\nb\n"))
+	if err != nil {
+		t.Fatalf("could not commit: %s\n", err)
+	}
+	checkDrift(t, c, recipes, DriftUpToDate)
+
+	os.Chmod(base, 0644)
+	c.Declare(FileAttributes{Mode: "0600"})
+	checkDrift(t, c, recipes, DriftAttributes)
+	_, errs := c.Drift(recipes)
+	if len(errs) != 1 || errs[0].Error() != "Mode is 0644, expected 0600!" {
+		t.Errorf("unexpected description of attributes: %v\n", errs)
+	}
+
+	writeTempFile(t, base, []byte("a\nb\nedited\n"))
+	checkDrift(t, newConfig(t, base), recipes, DriftDrifted)
+	c = newConfig(t, base)
+	c.Declare(FileAttributes{Mode: "0600"})
+	checkDrift(t, c, recipes, DriftDrifted)
+	_, errs = c.Drift(recipes)
+	if len(errs) != 1 || errs[0].Error() != "Mode is 0644, expected 0600!" {
+		t.Errorf("attributes should be described if drifted: %v\n", errs)
+	}
+
+	writeTempFile(t, base, []byte("a\nb\n"))
+	c = newConfig(t, base)
+	c.Declare(FileAttributes{Group: "nonexistent-group"})
+	checkDrift(t, c, recipes, DriftAttributes)
+	_, errs = c.Drift(recipes)
+	if len(errs) != 1 || errs[0].Error() != "Unknown group 'nonexistent-group'!" {
+		t.Errorf("unknown group should be reported: %v\n", errs)
+	}
+
+	writeTempFile(t, base+".pacnew", []byte("new\n"))
+	checkDrift(t, newConfig(t, base), recipes, DriftPendingUpdate)
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A migration rewrites the root node of a recipe to the next version.
+type migration func(d *nodeDecoder, root *yaml.Node)
+
+// migrations[i] migrates recipes from version i+1 to i+2. When the format
+// changes incompatibly, a migration is added here and CurrentVersion goes up.
+var migrations = []migration{}
+
+// CurrentVersion is the newest version of the recipe format. Recipes without
+// 'version' are in version 1.
+var CurrentVersion = len(migrations) + 1
+
+// Call f for all mapping nodes of entries in delete and replace, following
+// aliases and merge keys. Every node is visited only once. Migrations use it
+// to rewrite keys of entries.
+func forEachEntry(root *yaml.Node, f func(entry *yaml.Node)) {
+	visited := make(map[*yaml.Node]bool)
+	var visit func(n *yaml.Node)
+	visit = func(n *yaml.Node) {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		if n.Kind != yaml.MappingNode || visited[n] {
+			return
+		}
+		visited[n] = true
+		f(n)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag == "!!merge" {
+				visit(n.Content[i+1])
+			}
+		}
+	}
+
+	for _, key := range []string{"delete", "replace"} {
+		entries := mappingValue(root, key)
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, item := range entries.Content {
+			visit(item)
+		}
+	}
+}
+
+// Return the version of the recipe with root node, 1 if unset.
+func (d *nodeDecoder) version(root *yaml.Node) (int, *yaml.Node) {
+	n := mappingValue(root, "version")
+	if n == nil {
+		return 1, nil
+	}
+	if n.Kind != yaml.ScalarNode || n.ShortTag() != "!!int" {
+		d.errorf(n, "version", "Expected an integer!")
+		return 0, n
+	}
+	version, err := strconv.Atoi(n.Value)
+	if err != nil || version < 1 {
+		d.errorf(n, "version", "Invalid version '%s'!", n.Value)
+		return 0, n
+	}
+	if version > CurrentVersion {
+		d.errorf(n, "version", "Recipe requires version %d of the format, but this version of DynConf only supports up to %d!", version, CurrentVersion)
+		return 0, n
+	}
+	return version, n
+}
+
+// Migrate the recipe with root node to CurrentVersion, updating or inserting
+// 'version'. Returns the version of the recipe before migrating.
+func (d *nodeDecoder) migrate(root *yaml.Node) int {
+	if root.Kind != yaml.MappingNode {
+		// Will be reported by check.
+		return CurrentVersion
+	}
+
+	version, n := d.version(root)
+	if version == 0 {
+		return 0
+	}
+	for v := version; v < CurrentVersion; v++ {
+		migrations[v-1](d, root)
+	}
+
+	if n == nil {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		n = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int"}
+		if len(root.Content) > 0 {
+			// Keep comments at the beginning of the recipe in front.
+			first := root.Content[0]
+			key.HeadComment, first.HeadComment = first.HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{key, n}, root.Content...)
+	}
+	n.Value = strconv.Itoa(CurrentVersion)
+
+	return version
+}
+
+// Migrate reads a recipe from data and writes it in CurrentVersion of the
+// format to w, preserving comments. It returns the version of the recipe
+// before migrating. Recipes that it extends are not migrated.
+func Migrate(filename string, data []byte, w io.Writer) (int, error) {
+	d := nodeDecoder{file: filename}
+	doc := d.parseDocument(data)
+	if doc == nil {
+		return 0, d.errs
+	}
+	root := doc.Content[0]
+	version := d.migrate(root)
+	if len(d.errs) > 0 {
+		return 0, d.errs
+	}
+
+	// Make sure the migrated recipe is valid.
+	d.decodeRecipe(root)
+	if len(d.errs) > 0 {
+		return 0, d.errs
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(doc)
+	if err != nil {
+		return 0, err
+	}
+	return version, enc.Close()
+}
+
+// MigrateFile rewrites the recipe in filename to CurrentVersion of the format,
+// preserving comments. Recipes that are already in CurrentVersion are not
+// modified. It returns the version of the recipe before migrating.
+func MigrateFile(filename string) (int, error) {
+	if format := FormatOf(filename); format != FormatYAML {
+		return 0, fmt.Errorf("Only YAML recipes can be migrated, not %s!", format)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	version, err := Migrate(filename, data, &buf)
+	if err != nil || version == CurrentVersion {
+		return version, err
+	}
+
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+	err = writeFile(filename, buf.Bytes(), stat)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier:	GPL-3.0-or-later
+
+package dynconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pretend that the next version of the format renamed 'expect' to
+// 'checkCount', until the returned function is called.
+func useTestMigration() func() {
+	saved, savedVersion := migrations, CurrentVersion
+	migrations = append(migrations[:len(migrations):len(migrations)], func(d *nodeDecoder, root *yaml.Node) {
+		forEachEntry(root, func(entry *yaml.Node) {
+			for i := 0; i+1 < len(entry.Content); i += 2 {
+				if key := entry.Content[i]; key.Value == "expect" {
+					key.Value = "checkCount"
+				}
+			}
+		})
+	})
+	CurrentVersion = len(migrations) + 1
+	return func() {
+		migrations, CurrentVersion = saved, savedVersion
+	}
+}
+
+// A recipe in version 1 while the test migration is used.
+const legacyRecipe = `# Leading comment
+file: "/etc/test.conf"
+
+delete:
+  -
+    search: "remove"
+    # Expect exactly one line.
+    expect: 1
+
+replace:
+  - &port
+    search: "Port .*"
+    replace: "Port 22"
+    expect: 2
+  - *port
+`
+
+func TestRead_Version(t *testing.T) {
+	defer useTestMigration()()
+
+	for _, recipe := range []string{
+		legacyRecipe,
+		"version: 1\n" + legacyRecipe,
+		"version: 2\nfile: '/etc/test.conf'\ndelete: [{search: 'remove', checkCount: 1}]\nreplace: [{search: 'Port .*', replace: 'Port 22', checkCount: 2}]",
+	} {
+		filename := writeRecipe(t, recipe)
+		defer os.Remove(filename)
+
+		var r Recipe
+		err := r.Read(filename)
+		if err != nil {
+			t.Errorf("could not read recipe: %s\n%s", err, recipe)
+			continue
+		}
+		if r.Version != CurrentVersion {
+			t.Errorf("version should be %d: %d\n", CurrentVersion, r.Version)
+		}
+		if len(r.Delete) != 1 || r.Delete[0].CheckCount != 1 {
+			t.Errorf("count of delete was not decoded: %v\n", r.Delete)
+		}
+		if len(r.Replace) == 0 || r.Replace[0].CheckCount != 2 {
+			t.Errorf("count of replace was not decoded: %v\n", r.Replace)
+		}
+	}
+}
+
+func checkVersionErrors(t *testing.T, errors map[string]string) {
+	for recipe, msg := range errors {
+		filename := writeRecipe(t, recipe)
+		defer os.Remove(filename)
+
+		var r Recipe
+		err := r.Read(filename)
+		if err == nil || err.Error() != filename+msg {
+			t.Errorf("unexpected error for %q: %v\n", recipe, err)
+		}
+	}
+}
+
+func TestRead_VersionErrors(t *testing.T) {
+	checkVersionErrors(t, map[string]string{
+		"version: 2\nfile: '/etc/test.conf'":     ":1:10: version: Recipe requires version 2 of the format, but this version of DynConf only supports up to 1!",
+		"version: 0\nfile: '/etc/test.conf'":     ":1:10: version: Invalid version '0'!",
+		"version: 'two'\nfile: '/etc/test.conf'": ":1:10: version: Expected an integer!",
+	})
+
+	defer useTestMigration()()
+	checkVersionErrors(t, map[string]string{
+		"version: 3\nfile: '/etc/test.conf'":                  ":1:10: version: Recipe requires version 3 of the format, but this version of DynConf only supports up to 2!",
+		"version: 2\ndelete: [{search: 'remove', expect: 1}]": ":2:29: delete[0]: Unknown field 'expect'!",
+	})
+}
+
+func TestRead_ExtendsVersion(t *testing.T) {
+	defer useTestMigration()()
+
+	dir := writeRecipes(t, map[string]string{
+		"base.yml": legacyRecipe,
+		"host.yml": "version: 2\nextends: 'base.yml'\ndelete: [{search: 'host', checkCount: 3}]",
+	})
+	defer os.RemoveAll(dir)
+
+	var r Recipe
+	err := r.Read(path.Join(dir, "host.yml"))
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+	if len(r.Delete) != 2 || r.Delete[0].CheckCount != 1 || r.Delete[1].CheckCount != 3 {
+		t.Errorf("entries were not merged correctly: %v\n", r.Delete)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	defer useTestMigration()()
+
+	var buf bytes.Buffer
+	version, err := Migrate("recipe.yml", []byte(legacyRecipe), &buf)
+	if err != nil {
+		t.Fatalf("could not migrate recipe: %s\n", err)
+	}
+	if version != 1 {
+		t.Errorf("recipe should be in version 1: %d\n", version)
+	}
+
+	migrated := buf.String()
+	if !strings.HasPrefix(migrated, "# Leading comment\nversion: 2\n") {
+		t.Errorf("version should be inserted after the leading comment:\n%s", migrated)
+	}
+	if !strings.Contains(migrated, "# Expect exactly one line.") {
+		t.Errorf("comments should be preserved:\n%s", migrated)
+	}
+	if strings.Contains(migrated, "expect:") {
+		t.Errorf("expect should be renamed:\n%s", migrated)
+	}
+
+	// Both recipes must be equivalent.
+	filename := writeRecipe(t, legacyRecipe)
+	defer os.Remove(filename)
+	migratedFilename := writeRecipe(t, migrated)
+	defer os.Remove(migratedFilename)
+
+	var r, m Recipe
+	err = r.Read(filename)
+	if err != nil {
+		t.Fatalf("could not read recipe: %s\n", err)
+	}
+	err = m.Read(migratedFilename)
+	if err != nil {
+		t.Fatalf("could not read migrated recipe: %s\n%s", err, migrated)
+	}
+
+	var rBuf, mBuf bytes.Buffer
+	r.Encode(&rBuf)
+	m.Encode(&mBuf)
+	if rBuf.String() != mBuf.String() {
+		t.Errorf("migrated recipe differs:\n%s\n%s", rBuf.String(), mBuf.String())
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	defer useTestMigration()()
+
+	filename := writeRecipe(t, legacyRecipe)
+	defer os.Remove(filename)
+
+	version, err := MigrateFile(filename)
+	if err != nil {
+		t.Fatalf("could not migrate recipe: %s\n", err)
+	} else if version != 1 {
+		t.Errorf("recipe should be in version 1: %d\n", version)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("could not read migrated recipe: %s\n", err)
+	}
+
+	// The second migration should not modify the file.
+	version, err = MigrateFile(filename)
+	if err != nil {
+		t.Fatalf("could not migrate recipe: %s\n", err)
+	} else if version != CurrentVersion {
+		t.Errorf("recipe should be in version %d: %d\n", CurrentVersion, version)
+	}
+	checkContent(t, filename, data)
+}
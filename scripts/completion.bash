@@ -1,14 +1,57 @@
 #/usr/bin/env bash
 
+# Complete directories and files with the given extensions.
+_dynconf_files() {
+	compopt -o filenames
+	COMPREPLY=($(compgen -d -- "$cur"))
+	for ext in "$@"; do
+		COMPREPLY+=($(compgen -f -X "!*.$ext" -- "$cur"))
+	done
+}
+
 _dynconf_completion() {
 	words=${#COMP_WORDS[@]}
+	cur="${COMP_WORDS[COMP_CWORD]}"
 	if [ $words -le 2 ]; then
-		COMPREPLY=($(compgen -W "apply check show help version" -- "${COMP_WORDS[1]}"))
-	elif [ $words -eq 3 ]; then
+		COMPREPLY=($(compgen -W "apply check fmt history lint migrate rollback schema show status help version" -- "${COMP_WORDS[1]}"))
+	else
 		subcommand="${COMP_WORDS[1]}"
-		if [ "$subcommand" == "apply" ] || [ "$subcommand" == "check" ] || [ "$subcommand" == "show" ]; then
-			compopt -o filenames
-			COMPREPLY=($(compgen -f -X "!*.yml" -- "${COMP_WORDS[2]}") $(compgen -d -- "${COMP_WORDS[2]}"))
+		if [ "$subcommand" == "apply" ] || [ "$subcommand" == "check" ] || [ "$subcommand" == "lint" ] || [ "$subcommand" == "migrate" ] || [ "$subcommand" == "show" ] || [ "$subcommand" == "status" ]; then
+			if [[ "$cur" == -* ]]; then
+				options="--all --base-dir --format --name --tag"
+				if [ "$subcommand" == "apply" ]; then
+					options="$options --force --merge --prefer --settings --state-dir"
+				elif [ "$subcommand" == "check" ]; then
+					options="$options --effective --prefer --settings --state-dir"
+				elif [ "$subcommand" == "migrate" ]; then
+					# The other options are only accepted with --orig.
+					if [[ " ${COMP_WORDS[*]} " == *" --orig "* ]]; then
+						options="$options --prefer --settings --state-dir"
+					else
+						options="--orig"
+					fi
+				elif [ "$subcommand" == "show" ]; then
+					options="$options --prefer --settings --state-dir --trace"
+				elif [ "$subcommand" == "status" ]; then
+					options="$options --prefer --reconcile --settings --state-dir"
+				fi
+				COMPREPLY=($(compgen -W "$options" -- "$cur"))
+			else
+				_dynconf_files yml yaml json toml
+			fi
+		elif [ "$subcommand" == "history" ] || [ "$subcommand" == "rollback" ]; then
+			if [[ "$cur" == -* ]]; then
+				COMPREPLY=($(compgen -W "--settings --state-dir" -- "$cur"))
+			else
+				compopt -o filenames
+				COMPREPLY=($(compgen -f -- "$cur"))
+			fi
+		elif [ "$subcommand" == "fmt" ]; then
+			if [[ "$cur" == -* ]]; then
+				COMPREPLY=($(compgen -W "-w" -- "$cur"))
+			else
+				_dynconf_files yml yaml
+			fi
 		fi
 	fi
 }